@@ -0,0 +1,37 @@
+package main
+
+import (
+	"os"
+
+	"github.com/mostlygeek/normandy-tools/commands/countbymonth"
+	"github.com/mostlygeek/normandy-tools/commands/countfilterobjects"
+	"github.com/mostlygeek/normandy-tools/commands/diff"
+	"github.com/mostlygeek/normandy-tools/commands/filterexpressions"
+	"github.com/mostlygeek/normandy-tools/commands/findchangedjexl"
+	"github.com/mostlygeek/normandy-tools/commands/findoverlaps"
+	"github.com/mostlygeek/normandy-tools/commands/list"
+	"github.com/mostlygeek/normandy-tools/commands/matchclient"
+	"github.com/mostlygeek/normandy-tools/commands/prefconflicts"
+	"github.com/mostlygeek/normandy-tools/commands/showchanges"
+	"github.com/mostlygeek/normandy-tools/commands/sync"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// normandy-tools runs one of the reports, see "normandy-tools help"
+var commands = []*tools.Command{
+	list.Command,
+	countfilterobjects.Command,
+	findchangedjexl.Command,
+	showchanges.Command,
+	countbymonth.Command,
+	filterexpressions.Command,
+	matchclient.Command,
+	findoverlaps.Command,
+	prefconflicts.Command,
+	sync.Command,
+	diff.Command,
+}
+
+func main() {
+	os.Exit(tools.Main("normandy-tools", commands, os.Args[1:]))
+}
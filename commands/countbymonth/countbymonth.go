@@ -0,0 +1,215 @@
+// Package countbymonth is the count-by-month command
+package countbymonth
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// this will iterate through all of normandy's recipes and product this kind of output:
+//
+// Date			Type				Created			Updated			Paused
+// ----    		____				-------			-------			------
+// 2020-07-07	recipe-type				  5				  3				 7
+// 2020-07-07	recipe-type				  5				  3				 7
+// 2020-07-07	recipe-type				  5				  3				 7
+// 2020-07-06	recipe-type				  5				  3				 7
+// 2020-07-06	recipe-type				  5				  3				 7
+//
+// Date     - the day (YYYY-MM-DD) the recipes were enabled, updated or paused
+// Type     - the action type of the recipe, ie: preference-experiment
+// Created  - times a disabled recipe was turned on (launches)
+// Updated  - revisions that went live while a recipe stayed enabled
+// Paused   - times an enabled recipe was turned off
+//
+// -format, -columns and -sort change how the DataRecords are printed
+var Command = &tools.Command{
+	Name:  "count-by-month",
+	Short: "count launches, updates and pauses per day and recipe type",
+	Long: `
+Walks the revision history of every recipe and counts, per day and action:
+
+    Created  - times a disabled recipe was turned on (launches)
+    Updated  - revisions that went live while a recipe stayed enabled
+    Paused   - times an enabled recipe was turned off
+
+Like show-changes, when recipes were enabled and disabled comes from their
+revisions' enabled_states, drafts don't count.  If no revision of a recipe
+has enabled_states each one counts from when it was made.
+
+Columns: date recipe_type created updated paused
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+type DataRecord struct {
+	Date       string `json:"date"`
+	RecipeType string `json:"recipe_type"`
+	Created    int    `json:"created"`
+	Updated    int    `json:"updated"`
+	Paused     int    `json:"paused"`
+}
+
+func key(r *DataRecord) string {
+	return r.Date + "-" + r.RecipeType
+}
+
+// Data aggregates DataRecords by date and recipe type
+type Data struct {
+	sync.Mutex
+	data map[string]*DataRecord
+}
+
+func NewData() *Data {
+	return &Data{
+		data: make(map[string]*DataRecord),
+	}
+}
+
+// Record finds (or creates) the DataRecord for the date and type and
+// lets update modify it while the lock is held
+func (d *Data) Record(date, recipeType string, update func(*DataRecord)) {
+	d.Lock()
+	defer d.Unlock()
+
+	r := &DataRecord{Date: date, RecipeType: recipeType}
+	if existing, ok := d.data[key(r)]; ok {
+		r = existing
+	} else {
+		d.data[key(r)] = r
+	}
+
+	update(r)
+}
+
+// Records returns the DataRecords sorted newest date first, then by type
+func (d *Data) Records() []DataRecord {
+	d.Lock()
+	defer d.Unlock()
+
+	list := make([]DataRecord, 0, len(d.data))
+	for _, r := range d.data {
+		list = append(list, *r)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Date != list[j].Date {
+			return list[i].Date > list[j].Date
+		}
+		return list[i].RecipeType < list[j].RecipeType
+	})
+
+	return list
+}
+
+// countTransitions works out the launches, updates and pauses in a recipe's
+// revision history and adds them to data.  Launches and pauses come from the
+// recipe's timeline, updates are revisions that went live while the recipe
+// stayed enabled.
+func countTransitions(data *Data, history []tools.Revision) {
+	// the API returns the newest revision first but lets not assume things
+	sort.SliceStable(history, func(i, j int) bool {
+		return tools.RFC3339ToUnix(history[i].DateCreated) < tools.RFC3339ToUnix(history[j].DateCreated)
+	})
+	if len(history) == 0 {
+		return
+	}
+
+	// recipes don't change action, the newest revision has the right one
+	actionType := history[len(history)-1].Action.Name
+
+	count := func(ts string, update func(*DataRecord)) {
+		if len(ts) < 10 || !tools.TimeWindow.Contains(ts) {
+			return
+		}
+		data.Record(ts[0:10], actionType, update)
+	}
+
+	wasEnabled := false
+	for _, i := range tools.NewTimeline(history, time.Now()) {
+		ts := i.Start.Format(time.RFC3339)
+		switch {
+		case i.Enabled:
+			count(ts, func(r *DataRecord) { r.Created++ })
+		case wasEnabled:
+			count(ts, func(r *DataRecord) { r.Paused++ })
+		}
+		wasEnabled = i.Enabled
+	}
+
+	// a revision approved while the recipe is enabled gets a state carried
+	// over from the previous one
+	if tools.HasEnabledStates(history) {
+		for _, h := range history {
+			for _, state := range h.EnabledStates {
+				if state.Enabled && state.CarryoverFrom != nil {
+					count(state.Created, func(r *DataRecord) { r.Updated++ })
+				}
+			}
+		}
+		return
+	}
+
+	wasEnabled = false
+	for _, h := range history {
+		if len(h.DateCreated) < 10 {
+			tools.Log.Warn("Invalid revision date", "revision", h.ID, "date", h.DateCreated)
+			continue
+		}
+		if h.Enabled && wasEnabled {
+			count(h.DateCreated, func(r *DataRecord) { r.Updated++ })
+		}
+		wasEnabled = h.Enabled
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	data := NewData()
+
+	baseUrl := tools.RecipeURL()
+
+	// lots of workers to load and process data fast
+	pool := tools.NewPool(ctx, tools.Workers)
+
+	err := tools.WalkRecipesParallel(ctx, baseUrl, tools.Workers, tools.Lenient, func(recipe *tools.Recipe) error {
+		url := fmt.Sprintf("%s%d/history/", baseUrl, recipe.ID)
+		return pool.Submit(url, func(ctx context.Context) (interface{}, error) {
+			body, err := tools.GetContext(ctx, url)
+			if err != nil {
+				return nil, err
+			}
+
+			history, err := tools.DecodeHistory(body, tools.Lenient)
+			if err != nil {
+				return nil, err
+			}
+
+			countTransitions(data, history)
+			return nil, nil
+		})
+	})
+
+	for _, result := range pool.Wait() {
+		if result.Err != nil && result.Err != ctx.Err() {
+			tools.Log.Warn("Error fetching revisions", "url", result.Name, "err", result.Err)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	table := tools.NewTable("date", "recipe_type", "created", "updated", "paused")
+	for _, r := range data.Records() {
+		table.Add(r.Date, r.RecipeType, r.Created, r.Updated, r.Paused)
+	}
+	return tools.Output(table)
+}
@@ -0,0 +1,67 @@
+package countbymonth
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+func TestCountTransitions(t *testing.T) {
+	tests := []struct {
+		name    string
+		history string
+		want    []DataRecord
+	}{
+		{
+			// enabled on the 2nd, revision 2 approved live on the 4th, paused
+			// on the 6th.  Revision 3 is a draft.
+			name: "enabled states",
+			history: `[
+				{"id": 3, "date_created": "2020-01-07T00:00:00Z", "enabled": false, "action": {"name": "opt-out-study"}},
+				{"id": 2, "date_created": "2020-01-03T00:00:00Z", "enabled": false, "action": {"name": "opt-out-study"}, "enabled_states": [
+					{"id": 13, "created": "2020-01-06T00:00:00Z", "enabled": false},
+					{"id": 12, "created": "2020-01-04T00:00:00Z", "enabled": true, "carryover_from": 11}
+				]},
+				{"id": 1, "date_created": "2020-01-01T00:00:00Z", "enabled": false, "action": {"name": "opt-out-study"}, "enabled_states": [
+					{"id": 11, "created": "2020-01-02T00:00:00Z", "enabled": true}
+				]}
+			]`,
+			want: []DataRecord{
+				{Date: "2020-01-06", RecipeType: "opt-out-study", Paused: 1},
+				{Date: "2020-01-04", RecipeType: "opt-out-study", Updated: 1},
+				{Date: "2020-01-02", RecipeType: "opt-out-study", Created: 1},
+			},
+		},
+		{
+			name: "no enabled states",
+			history: `[
+				{"id": 4, "date_created": "2020-01-05T00:00:00Z", "enabled": true, "action": {"name": "show-heartbeat"}},
+				{"id": 3, "date_created": "2020-01-04T00:00:00Z", "enabled": false, "action": {"name": "show-heartbeat"}},
+				{"id": 2, "date_created": "2020-01-02T00:00:00Z", "enabled": true, "action": {"name": "show-heartbeat"}},
+				{"id": 1, "date_created": "2020-01-01T00:00:00Z", "enabled": true, "action": {"name": "show-heartbeat"}}
+			]`,
+			want: []DataRecord{
+				{Date: "2020-01-05", RecipeType: "show-heartbeat", Created: 1},
+				{Date: "2020-01-04", RecipeType: "show-heartbeat", Paused: 1},
+				{Date: "2020-01-02", RecipeType: "show-heartbeat", Updated: 1},
+				{Date: "2020-01-01", RecipeType: "show-heartbeat", Created: 1},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history, err := tools.DecodeHistory([]byte(test.history), tools.Lenient)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			data := NewData()
+			countTransitions(data, history)
+			if got := data.Records(); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("counted %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,170 @@
+// Package countfilterobjects is the count-filterobjects command
+package countfilterobjects
+
+import (
+	"context"
+	"flag"
+	"math"
+	"sort"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+	"github.com/pkg/errors"
+)
+
+// downloads all the current recipes and count the ones that are only filter expressions
+var Command = &tools.Command{
+	Name:  "count-filterobjects",
+	Short: "count recipes using filter objects by month",
+	Long: `
+Downloads all the current recipes and counts, per month of their latest
+revision, how many use filter objects and how many use only filter objects
+(no extra_filter_expression).  Experiments and heartbeats are counted
+separately, console-log recipes are skipped.
+
+A recipe has filter objects when its filter_object list isn't empty, even
+if they don't pass validation or are of a type this tool doesn't know.
+Invalid ones are logged as warnings and unknown types as info.
+
+Columns: kind month total has_fo has_fo_pct fo_only fo_only_pct
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+type stats struct {
+	count  int
+	usesFO int
+	onlyFO int
+}
+
+var (
+	statList map[string]*stats
+	statHB   map[string]*stats
+)
+
+// process adds recipe to the stats.  The parallel walker hands out recipes
+// one at a time so no locking is needed.
+func process(recipe *tools.Recipe) error {
+	rev := recipe.LatestRevision
+	if rev == nil {
+		tools.Log.Warn("No latest revision", "recipe", recipe.ID)
+		return nil
+	}
+
+	// separate Experiment and Heartbeat stats, reassign later depending on experiment type
+	useStats := statList
+
+	// Exclude heartbeat/console-log action types
+	actionType := rev.Action.Name
+	if actionType == "console-log" {
+		return nil
+	} else if actionType == "show-heartbeat" {
+		useStats = statHB
+	}
+
+	if !tools.TimeWindow.Revision(rev) {
+		return nil
+	}
+
+	date := tools.TimeWindow.RevisionDate(rev)
+	if len(date) < 7 {
+		tools.Log.Warn("Invalid revision date", "recipe", recipe.ID, "date", date)
+		return nil
+	}
+
+	key := date[0:7]
+	stat, ok := useStats[key]
+	if !ok { // create it if it doesn't exist
+		stat = &stats{}
+		useStats[key] = stat
+	}
+
+	// filter objects count when they're there, bad ones are only logged
+	checkFilterObjects(recipe.ID, rev)
+	hasFO := len(rev.FilterObject) > 0
+
+	// an *exclusively* filter_object recipe should:
+	//   - extra_filter_expression should be ""
+	//   - filter_objects should have 1 or more elements
+	stat.count++
+	if hasFO {
+		stat.usesFO++
+	}
+
+	if len(rev.ExtraFilterExpression) == 0 && hasFO {
+		stat.onlyFO++
+	}
+
+	return nil
+}
+
+// checkFilterObjects logs the revision's filter objects that don't validate.
+// Types the tools don't know are logged on their own, Normandy may well
+// accept them.
+func checkFilterObjects(id int, rev *tools.Revision) {
+	for i, fo := range rev.FilterObject {
+		filter, err := fo.Decode()
+		if errors.Is(err, tools.ErrUnknownFilterType) {
+			tools.Log.Info("Unknown filter object type", "recipe", id, "type", fo.Type)
+			continue
+		}
+
+		if err == nil {
+			err = filter.Validate()
+		}
+		if err != nil {
+			tools.Log.Warn("Invalid filter object", "recipe", id, "index", i, "err", err)
+		}
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+
+	statList = make(map[string]*stats)
+	statHB = make(map[string]*stats)
+
+	baseUrl := tools.RecipeURL()
+
+	if dir := tools.Cachedir(); dir != "" && tools.CurrentSnapshot() == nil {
+		tools.Log.Info("Using cached responses, use -refresh to revalidate them", "dir", dir)
+	}
+
+	// lots of workers to load the pages fast
+	err := tools.WalkRecipesParallel(ctx, baseUrl, tools.Workers, tools.Lenient, process)
+	if errors.Is(err, tools.ErrPagesShifted) {
+		tools.Log.Warn("Recipes changed while loading, counts may be off", "err", err)
+	} else if err != nil {
+		return err
+	}
+
+	table := tools.NewTable("kind", "month", "total", "has_fo", "has_fo_pct", "fo_only", "fo_only_pct")
+	for _, kind := range []string{"experiment", "heartbeat"} {
+		statListToUse := statList
+		if kind == "heartbeat" {
+			statListToUse = statHB
+		}
+
+		// YYYY-MM keys sort in month order
+		keys := make([]string, 0, len(statListToUse))
+		for key := range statListToUse {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			stat := statListToUse[key]
+			table.Add(kind, key,
+				stat.count,
+				stat.usesFO, percent(stat.usesFO, stat.count),
+				stat.onlyFO, percent(stat.onlyFO, stat.count))
+		}
+	}
+
+	return tools.Output(table)
+}
+
+// percent is n of total, rounded to 2 decimals
+func percent(n, total int) float64 {
+	return math.Round(float64(n)/float64(total)*10000) / 100
+}
@@ -0,0 +1,376 @@
+// Package diff is the diff command
+package diff
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// compares two snapshots from the local store and lists what happened to the
+// recipes in between: added, removed, enabled, disabled or revised.  For
+// revised recipes the fields of the latest revision that changed are listed.
+var Command = &tools.Command{
+	Name:  "diff",
+	Usage: "[flags] [from] [to]",
+	Short: "list recipes added, removed, enabled, disabled or revised between two snapshots",
+	Long: `
+Compares two snapshots saved by sync and lists the recipes that were added,
+removed, enabled, disabled or got a new revision in between.
+
+from and to are "latest", a snapshot file or a time, which picks the last
+snapshot made at or before it, ie: 2020-06-30 or 7d.  to defaults to latest
+and from to the snapshot before to.
+
+For revised recipes fields lists what changed in the latest revision:
+action, arguments (with the argument names), filter_object and
+extra_filter_expression.  Expressions are compared after canonicalizing
+them, like find-changed-jexl does.  new_revisions is how many revisions were
+made in between.
+
+enabled and disabled go by the approved revision, a new draft doesn't change
+whether a recipe is running.  from_revision and to_revision are the approved
+revisions for them.
+
+Columns: id action slug change from_revision to_revision new_revisions date fields
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+// the kinds of changes, in the order they are listed for a recipe
+const (
+	Added    = "added"
+	Removed  = "removed"
+	Revised  = "revised"
+	Enabled  = "enabled"
+	Disabled = "disabled"
+)
+
+// Change is something that happened to a recipe between two snapshots
+type Change struct {
+	ID   int
+	Kind string
+
+	// From and To are the latest revisions, From is nil for added recipes
+	// and To for removed ones.  For Enabled and Disabled they are the
+	// approved revisions, either can be nil when there wasn't one.
+	From, To *tools.Revision
+
+	// Fields changed from From to To, only for Revised
+	Fields []string
+
+	// NewRevisions is how many revisions To's history has after From, all of
+	// them for Added
+	NewRevisions int
+}
+
+// snapshots picks the two snapshots to compare from the arguments
+func snapshots(store *tools.Store, args []string) (from, to tools.SnapshotInfo, err error) {
+	now := time.Now()
+	if len(args) > 2 {
+		return from, to, tools.Usagef("Only two snapshots can be compared")
+	}
+
+	toSpec := "latest"
+	if len(args) == 2 {
+		toSpec = args[1]
+	}
+	if to, err = store.Find(toSpec, now); err != nil {
+		return
+	}
+
+	if len(args) > 0 {
+		from, err = store.Find(args[0], now)
+		return
+	}
+
+	// the one before to
+	list, err := store.Snapshots()
+	if err != nil {
+		return
+	}
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Created.Before(to.Created) {
+			return list[i], to, nil
+		}
+	}
+	return from, to, tools.Usagef("There is no snapshot before %s to compare it to", to.Path)
+}
+
+func run(ctx context.Context, args []string) error {
+	store := tools.CurrentStore()
+	fromInfo, toInfo, err := snapshots(store, args)
+	if err != nil {
+		return err
+	}
+
+	from, err := tools.LoadSnapshot(fromInfo.Path)
+	if err != nil {
+		return err
+	}
+	to, err := tools.LoadSnapshot(toInfo.Path)
+	if err != nil {
+		return err
+	}
+
+	tools.Log.Info("Comparing snapshots",
+		"from", from.Created.Format(time.RFC3339),
+		"to", to.Created.Format(time.RFC3339))
+
+	changes, err := Diff(from, to)
+	if err != nil {
+		return err
+	}
+
+	table := tools.NewTable("id", "action", "slug", "change", "from_revision", "to_revision", "new_revisions", "date", "fields")
+	for _, c := range changes {
+		// describe the recipe by its newest revision
+		rev := c.To
+		if rev == nil {
+			rev = c.From
+		}
+
+		var fromID, toID interface{}
+		if c.From != nil {
+			fromID = c.From.ID
+		}
+		if c.To != nil {
+			toID = c.To.ID
+		}
+
+		date := tools.TimeWindow.RevisionDate(rev)
+		if len(date) > 10 {
+			date = date[0:10]
+		}
+
+		table.Add(c.ID, rev.Action.Name, rev.Arguments.Slug, c.Kind, fromID, toID, c.NewRevisions, date, strings.Join(c.Fields, ","))
+	}
+	return tools.Output(table)
+}
+
+// Diff lists the changes between two snapshots, sorted by recipe id.
+// Recipes without a latest revision are skipped.
+func Diff(from, to *tools.Snapshot) ([]Change, error) {
+	ids := make(map[int]bool)
+	for _, r := range from.Recipes {
+		ids[r.ID] = true
+	}
+	for _, r := range to.Recipes {
+		ids[r.ID] = true
+	}
+
+	sorted := make([]int, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Ints(sorted)
+
+	var changes []Change
+	for _, id := range sorted {
+		before, err := decodeRecipe(from.Recipe(id))
+		if err != nil {
+			return nil, err
+		}
+		after, err := decodeRecipe(to.Recipe(id))
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case before == nil && after == nil:
+		case before == nil:
+			changes = append(changes, Change{ID: id, Kind: Added, To: after.LatestRevision, NewRevisions: newRevisions(to.Recipe(id), 0)})
+		case after == nil:
+			changes = append(changes, Change{ID: id, Kind: Removed, From: before.LatestRevision})
+		default:
+			changes = append(changes, recipeChanges(id, before, after, to.Recipe(id))...)
+		}
+	}
+	return changes, nil
+}
+
+// recipeChanges compares a recipe that is in both snapshots.  Revised looks
+// at the latest revisions, drafts included.  Whether the recipe is enabled
+// is up to the approved revision, a new draft doesn't stop it.
+func recipeChanges(id int, before, after *tools.Recipe, stored *tools.StoredRecipe) []Change {
+	var changes []Change
+
+	if from, to := before.LatestRevision, after.LatestRevision; from.ID != to.ID {
+		changes = append(changes, Change{
+			ID:           id,
+			Kind:         Revised,
+			From:         from,
+			To:           to,
+			Fields:       fields(from, to),
+			NewRevisions: newRevisions(stored, from.ID),
+		})
+	}
+
+	if wasLive, live := enabled(before), enabled(after); wasLive != live {
+		kind := Disabled
+		if live {
+			kind = Enabled
+		}
+		changes = append(changes, Change{ID: id, Kind: kind, From: before.ApprovedRevision, To: after.ApprovedRevision})
+	}
+
+	return changes
+}
+
+// enabled is true when the recipe's approved revision is enabled
+func enabled(recipe *tools.Recipe) bool {
+	return recipe.ApprovedRevision != nil && recipe.ApprovedRevision.Enabled
+}
+
+// newRevisions counts the revisions in the recipe's history made after the
+// revision with id, revision ids only go up
+func newRevisions(r *tools.StoredRecipe, id int) int {
+	history, err := tools.DecodeHistory(r.History, tools.Lenient)
+	if err != nil {
+		return 0
+	}
+
+	n := 0
+	for _, rev := range history {
+		if rev.ID > id {
+			n++
+		}
+	}
+	return n
+}
+
+// decodeRecipe decodes a stored recipe, it's nil when there isn't one or it
+// has no latest revision
+func decodeRecipe(r *tools.StoredRecipe) (*tools.Recipe, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	recipe, err := tools.DecodeRecipe(r.Recipe, tools.Lenient)
+	if err != nil || recipe.LatestRevision == nil {
+		return nil, err
+	}
+	return recipe, nil
+}
+
+// fields lists what changed between two revisions of a recipe
+func fields(before, after *tools.Revision) []string {
+	var changed []string
+
+	if before.Action.Name != after.Action.Name {
+		changed = append(changed, "action")
+	}
+
+	changed = append(changed, argumentChanges(before.Arguments.Raw, after.Arguments.Raw)...)
+
+	if !sameFilterObjects(before.FilterObject, after.FilterObject) {
+		changed = append(changed, "filter_object")
+	}
+
+	if !sameExpression(before.ExtraFilterExpression, after.ExtraFilterExpression) {
+		changed = append(changed, "extra_filter_expression")
+	}
+
+	return changed
+}
+
+// argumentChanges lists the arguments that were added, removed or changed as
+// arguments.<name>, or just arguments if they aren't JSON objects
+func argumentChanges(before, after json.RawMessage) []string {
+	var a, b map[string]json.RawMessage
+	if json.Unmarshal(before, &a) != nil || json.Unmarshal(after, &b) != nil {
+		if !bytes.Equal(compact(before), compact(after)) {
+			return []string{"arguments"}
+		}
+		return nil
+	}
+
+	var changed []string
+	for name, value := range a {
+		if other, ok := b[name]; !ok || !bytes.Equal(compact(value), compact(other)) {
+			changed = append(changed, "arguments."+name)
+		}
+	}
+	for name := range b {
+		if _, ok := a[name]; !ok {
+			changed = append(changed, "arguments."+name)
+		}
+	}
+
+	sort.Strings(changed)
+	return changed
+}
+
+// sameFilterObjects is true when both lists have the same filter objects, in
+// any order
+func sameFilterObjects(a, b []tools.FilterObject) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	encode := func(list []tools.FilterObject) []string {
+		s := make([]string, len(list))
+		for i, fo := range list {
+			s[i] = string(compact(fo.Raw))
+		}
+		sort.Strings(s)
+		return s
+	}
+
+	x, y := encode(a), encode(b)
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// sameExpression compares expressions after canonicalizing them, falling
+// back to comparing the source when either doesn't parse
+func sameExpression(a, b string) bool {
+	a, b = strings.TrimSpace(a), strings.TrimSpace(b)
+	if a == b {
+		return true
+	}
+	if a == "" || b == "" {
+		return false
+	}
+
+	x, err := jexl.Parse(a)
+	if err != nil {
+		return false
+	}
+	y, err := jexl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return jexl.Equal(x, y)
+}
+
+// compact normalizes JSON so formatting doesn't count as a change.  Object
+// keys are sorted too.
+func compact(data json.RawMessage) []byte {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		return data
+	}
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		return data
+	}
+	return out
+}
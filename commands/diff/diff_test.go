@@ -0,0 +1,275 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// revision is the JSON of a revision with args as its arguments
+func revision(id int, enabled bool, args string) string {
+	return fmt.Sprintf(`{"id": %d, "enabled": %v, "action": {"name": "opt-out-study"}, "arguments": %s}`, id, enabled, args)
+}
+
+// recipe is a stored recipe, approved can be "null".  The history is every
+// revision up to the latest.
+func recipe(id int, latest, approved string) tools.StoredRecipe {
+	var rev struct{ ID int }
+	json.Unmarshal([]byte(latest), &rev)
+
+	history := "["
+	for n := rev.ID; n > 0; n-- {
+		if n < rev.ID {
+			history += ","
+		}
+		history += fmt.Sprintf(`{"id": %d}`, n)
+	}
+	history += "]"
+
+	return tools.StoredRecipe{
+		ID:      id,
+		Recipe:  json.RawMessage(fmt.Sprintf(`{"id": %d, "latest_revision": %s, "approved_revision": %s}`, id, latest, approved)),
+		History: json.RawMessage(history),
+	}
+}
+
+// tempStore is an empty store that's removed when the test ends
+func tempStore(t *testing.T) *tools.Store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "normandy-tools-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &tools.Store{Dir: dir}
+}
+
+// snapshot saves recipes in store and loads them back
+func snapshot(t *testing.T, store *tools.Store, created time.Time, recipes ...tools.StoredRecipe) *tools.Snapshot {
+	t.Helper()
+
+	path, err := store.Save(recipes, "https://normandy.cdn.mozilla.net/api/v3/", created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := tools.LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestDiff(t *testing.T) {
+	type change struct {
+		ID           int
+		Kind         string
+		From, To     int // revision ids, 0 for none
+		Fields       []string
+		NewRevisions int
+	}
+
+	args := `{"slug": "a"}`
+	tests := []struct {
+		name     string
+		from, to []tools.StoredRecipe
+		want     []change
+	}{
+		{
+			name: "unchanged",
+			from: []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+			to:   []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+		},
+		{
+			name: "added",
+			to:   []tools.StoredRecipe{recipe(1, revision(2, false, args), "null")},
+			want: []change{{ID: 1, Kind: Added, To: 2, NewRevisions: 2}},
+		},
+		{
+			name: "removed",
+			from: []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+			want: []change{{ID: 1, Kind: Removed, From: 1}},
+		},
+		{
+			name: "revised and enabled",
+			from: []tools.StoredRecipe{recipe(1, revision(1, false, args), revision(1, false, args))},
+			to:   []tools.StoredRecipe{recipe(1, revision(3, true, `{"slug": "b"}`), revision(3, true, `{"slug": "b"}`))},
+			want: []change{
+				{ID: 1, Kind: Revised, From: 1, To: 3, Fields: []string{"arguments.slug"}, NewRevisions: 2},
+				{ID: 1, Kind: Enabled, From: 1, To: 3},
+			},
+		},
+		{
+			name: "disabled",
+			from: []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+			to:   []tools.StoredRecipe{recipe(1, revision(1, false, args), revision(1, false, args))},
+			want: []change{{ID: 1, Kind: Disabled, From: 1, To: 1}},
+		},
+		{
+			name: "first approval",
+			from: []tools.StoredRecipe{recipe(1, revision(1, false, args), "null")},
+			to:   []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+			want: []change{{ID: 1, Kind: Enabled, To: 1}},
+		},
+		{
+			// the live recipe keeps running while the draft waits
+			name: "draft of a live recipe",
+			from: []tools.StoredRecipe{recipe(1, revision(1, true, args), revision(1, true, args))},
+			to:   []tools.StoredRecipe{recipe(1, revision(2, false, `{"slug": "b"}`), revision(1, true, args))},
+			want: []change{{ID: 1, Kind: Revised, From: 1, To: 2, Fields: []string{"arguments.slug"}, NewRevisions: 1}},
+		},
+		{
+			name: "draft approved",
+			from: []tools.StoredRecipe{recipe(1, revision(2, false, args), revision(1, true, args))},
+			to:   []tools.StoredRecipe{recipe(1, revision(2, true, args), revision(2, true, args))},
+		},
+		{
+			name: "sorted by id",
+			from: []tools.StoredRecipe{recipe(3, revision(1, true, args), revision(1, true, args))},
+			to:   []tools.StoredRecipe{recipe(2, revision(1, false, args), "null")},
+			want: []change{
+				{ID: 2, Kind: Added, To: 1, NewRevisions: 1},
+				{ID: 3, Kind: Removed, From: 1},
+			},
+		},
+		{
+			name: "no latest revision",
+			to:   []tools.StoredRecipe{recipe(1, "null", "null")},
+		},
+	}
+
+	id := func(rev *tools.Revision) int {
+		if rev == nil {
+			return 0
+		}
+		return rev.ID
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			store := tempStore(t)
+			from := snapshot(t, store, time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC), test.from...)
+			to := snapshot(t, store, time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC), test.to...)
+
+			changes, err := Diff(from, to)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []change
+			for _, c := range changes {
+				got = append(got, change{c.ID, c.Kind, id(c.From), id(c.To), c.Fields, c.NewRevisions})
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestArgumentChanges(t *testing.T) {
+	tests := []struct {
+		before, after string
+		want          []string
+	}{
+		{`{"slug": "a", "branches": [{"ratio": 1}]}`, `{"branches":[{"ratio":1}],"slug":"a"}`, nil},
+		{`{"a": {"x": 1, "y": 2}}`, "{\n  \"a\": {\"y\": 2, \"x\": 1}\n}", nil},
+		{`{"slug": "a", "old": 1}`, `{"slug": "b", "new": 1}`, []string{"arguments.new", "arguments.old", "arguments.slug"}},
+		{`{"list": [1, 2]}`, `{"list": [2, 1]}`, []string{"arguments.list"}},
+		{`[1, 2]`, `[1,2]`, nil},
+		{`[1, 2]`, `{"a": 1}`, []string{"arguments"}},
+	}
+
+	for _, test := range tests {
+		got := argumentChanges(json.RawMessage(test.before), json.RawMessage(test.after))
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("argumentChanges(%s, %s) = %v, want %v", test.before, test.after, got, test.want)
+		}
+	}
+}
+
+func TestSameFilterObjects(t *testing.T) {
+	decode := func(s string) []tools.FilterObject {
+		var list []tools.FilterObject
+		if err := json.Unmarshal([]byte(s), &list); err != nil {
+			t.Fatal(err)
+		}
+		return list
+	}
+
+	channel := `{"type": "channel", "channels": ["release"]}`
+	locale := `{"type": "locale", "locales": ["de"]}`
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{`[` + channel + `,` + locale + `]`, `[` + locale + `,` + channel + `]`, true},
+		{`[` + channel + `]`, `[{"channels":["release"],"type":"channel"}]`, true},
+		{`[]`, `[]`, true},
+		{`[` + channel + `]`, `[` + locale + `]`, false},
+		{`[` + channel + `]`, `[` + channel + `,` + channel + `]`, false},
+		{`[` + channel + `,` + channel + `]`, `[` + channel + `,` + locale + `]`, false},
+	}
+
+	for _, test := range tests {
+		if got := sameFilterObjects(decode(test.a), decode(test.b)); got != test.want {
+			t.Errorf("sameFilterObjects(%s, %s) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	store := tempStore(t)
+
+	_, _, err := snapshots(store, nil)
+	if err == nil {
+		t.Error("no error without snapshots")
+	}
+
+	dates := []time.Time{
+		time.Date(2020, 6, 28, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 6, 30, 0, 0, 0, 0, time.UTC),
+		time.Date(2020, 7, 2, 0, 0, 0, 0, time.UTC),
+	}
+	for i, date := range dates {
+		snapshot(t, store, date)
+
+		// there has to be one to compare the first to
+		if _, _, err := snapshots(store, nil); (err == nil) != (i > 0) {
+			t.Errorf("%d snapshots: err = %v", i+1, err)
+		}
+	}
+
+	tests := []struct {
+		args     []string
+		from, to time.Time
+	}{
+		{nil, dates[1], dates[2]},
+		{[]string{"2020-06-28"}, dates[0], dates[2]},
+		{[]string{"2020-06-29", "2020-07-01"}, dates[0], dates[1]},
+		{[]string{"latest", "2020-06-28"}, dates[2], dates[0]},
+	}
+
+	for _, test := range tests {
+		from, to, err := snapshots(store, test.args)
+		if err != nil {
+			t.Errorf("snapshots(%v) error: %v", test.args, err)
+			continue
+		}
+		if !from.Created.Equal(test.from) || !to.Created.Equal(test.to) {
+			t.Errorf("snapshots(%v) = %s, %s, want %s, %s", test.args, from.Created, to.Created, test.from, test.to)
+		}
+	}
+
+	for _, args := range [][]string{{"a", "b", "c"}, {"2020-01-01"}, {"latest", "yesterday"}} {
+		if _, _, err := snapshots(store, args); err == nil {
+			t.Errorf("snapshots(%v) didn't fail", args)
+		}
+	}
+}
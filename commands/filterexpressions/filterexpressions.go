@@ -0,0 +1,91 @@
+// Package filterexpressions is the filter-expressions command
+package filterexpressions
+
+import (
+	"context"
+	"flag"
+	"strings"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+	"github.com/pkg/errors"
+)
+
+// goes through and dumps an easier to see pattern of filter expressions we write
+// that can't be handled in pure FilterObjects.  The output can be found in this gist:
+//
+// https://gist.github.com/mostlygeek/875b3a9a0127b2f046c21a6c62d9584e
+//
+// We are starting to turn complex, repeating experiment targeting with the new "preset_choices"
+// FilterObject.  Not sure if we are continue running complex experiments like this ...
+//
+// Each expression is also translated into the filter objects that would do the
+// same targeting.  Recipes are reported as fully convertible, partially
+// convertible (with the JEXL that's left over) or not convertible.
+var Command = &tools.Command{
+	Name:  "filter-expressions",
+	Short: "list extra filter expressions and what filter objects could replace them",
+	Long: `
+Prints the extra_filter_expression of every recipe that isn't show-heartbeat
+with the spacing normalized.
+
+Columns: date id action expression convertibility residual filter_object
+
+Each expression is also translated into the filter objects that would do the
+same targeting.  Recipes are reported as fully convertible, partially
+convertible (with the JEXL that's left over) or not convertible.
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+func run(ctx context.Context, args []string) error {
+	table := tools.NewTable("date", "id", "action", "expression", "convertibility", "residual", "filter_object")
+
+	baseUrl := tools.RecipeURL()
+	err := tools.WalkRecipes(ctx, baseUrl, tools.Lenient, func(recipe *tools.Recipe) error {
+		rev := recipe.LatestRevision
+		if rev == nil || len(rev.DateCreated) < 10 {
+			return errors.Errorf("No latest revision for %d", recipe.ID)
+		}
+
+		if !tools.TimeWindow.Revision(rev) {
+			return nil
+		}
+
+		if rev.Action.Name == "show-heartbeat" {
+			return nil
+		}
+
+		if strings.TrimSpace(rev.ExtraFilterExpression) == "" {
+			return nil
+		}
+
+		expr, err := jexl.Parse(rev.ExtraFilterExpression)
+		if err != nil {
+			tools.Log.Warn("Parse error", "recipe", recipe.ID, "err", err)
+			return nil
+		}
+
+		t := jexl.Translate(expr)
+		var residual string
+		var filterObject interface{}
+		switch t.Convertibility() {
+		case jexl.PartiallyConvertible:
+			residual = t.Residual.String()
+			filterObject = t.FilterObjects
+		case jexl.FullyConvertible:
+			filterObject = t.FilterObjects
+		}
+
+		// String() normalizes the spacing without touching what's in string literals
+		table.Add(rev.DateCreated[0:10], recipe.ID, rev.Action.Name, expr.String(), string(t.Convertibility()), residual, filterObject)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+	return tools.Output(table)
+}
@@ -0,0 +1,220 @@
+// Package findchangedjexl is the find-changed-jexl command
+package findchangedjexl
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// creates a table with this data
+// - id
+// - type
+// - num revisions
+// - FO Used
+// - number of revisions that really changed the filter expression
+//
+// JEXL is compared after canonicalizing it so reformatting or reordering
+// clauses doesn't count as a change.  With -changes each clause that was
+// added, removed or modified is listed instead.
+var Command = &tools.Command{
+	Name:  "find-changed-jexl",
+	Short: "count how often recipes really changed their filter expression",
+	Long: `
+Prints a line for every recipe that isn't show-heartbeat or console-log.
+
+Columns: id revisions action last_revision filter_object_used jexl_changes
+
+JEXL is compared after canonicalizing it so reformatting or reordering
+clauses doesn't count as a change.
+
+With -changes there's a line for every clause a revision added, removed or
+modified instead.
+
+Columns: id revision date change old new
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		changes = fs.Bool("changes", false, "list the clauses that changed instead of a line per recipe")
+		return run
+	},
+}
+
+var changes *bool
+
+type Record struct {
+	Id                      int
+	Action                  string
+	LastRevision            string
+	NumRevisions            int
+	FilterObjectUsed        bool
+	FilterExpressionChanges int
+	LastFilterExpression    string
+	Changes                 []Change
+}
+
+// Change is a revision that changed the filter expression
+type Change struct {
+	RevisionId int
+	Date       string
+	Clauses    []jexl.ClauseChange
+}
+
+// expression is a filter expression and its parsed form, Node is nil if
+// it didn't parse
+type expression struct {
+	Source string
+	Node   jexl.Node
+}
+
+func parseExpression(id int, src string) expression {
+	e := expression{Source: src}
+	if strings.TrimSpace(src) == "" {
+		return e
+	}
+
+	n, err := jexl.Parse(src)
+	if err != nil {
+		tools.Log.Warn("Parse error", "recipe", id, "err", err)
+		return e
+	}
+
+	e.Node = jexl.Canonical(n)
+	return e
+}
+
+// diff returns the clauses that changed from old to new, falling back to
+// comparing the whole source when either didn't parse
+func diff(old, new expression) []jexl.ClauseChange {
+	parsed := func(e expression) bool { return e.Node != nil || strings.TrimSpace(e.Source) == "" }
+	if parsed(old) && parsed(new) {
+		return jexl.Diff(old.Node, new.Node)
+	}
+
+	if strings.TrimSpace(old.Source) == strings.TrimSpace(new.Source) {
+		return nil
+	}
+	return []jexl.ClauseChange{{Kind: jexl.Modified, Old: old.Source, New: new.Source}}
+}
+
+// fetchRecord returns a task that builds the Record for a recipe from its
+// revision history
+func fetchRecord(url string, id int) tools.Task {
+	return func(ctx context.Context) (interface{}, error) {
+		body, err := tools.GetContext(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		history, err := tools.DecodeHistory(body, tools.Lenient)
+		if err != nil {
+			return nil, err
+		}
+
+		// the API sends the newest revision first, changes are worked
+		// out oldest to newest
+		sort.SliceStable(history, func(i, j int) bool {
+			return tools.RFC3339ToUnix(history[i].DateCreated) < tools.RFC3339ToUnix(history[j].DateCreated)
+		})
+
+		record := Record{Id: id}
+		var last expression
+		for i, revision := range history {
+			record.Action = revision.Action.Name
+			record.NumRevisions++
+
+			if len(revision.FilterObject) > 0 {
+				record.FilterObjectUsed = true
+			}
+
+			// manage time stamps in record
+			if tools.RFC3339ToUnix(record.LastRevision) < tools.RFC3339ToUnix(revision.Updated) {
+				record.LastRevision = revision.Updated
+			}
+
+			fe := parseExpression(id, revision.FilterExpression)
+			if i > 0 {
+				if clauses := diff(last, fe); len(clauses) > 0 {
+					record.FilterExpressionChanges++
+					record.Changes = append(record.Changes, Change{revision.ID, revision.DateCreated, clauses})
+				}
+			}
+
+			record.LastFilterExpression = fe.Source
+			last = fe
+		}
+
+		return record, nil
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	baseUrl := tools.RecipeURL()
+
+	// lots of workers to load and process data fast
+	pool := tools.NewPool(ctx, tools.Workers)
+
+	err := tools.WalkRecipes(ctx, baseUrl+"?ordering=-id", tools.Lenient, func(recipe *tools.Recipe) error {
+		rev := recipe.LatestRevision
+		if rev == nil {
+			tools.Log.Warn("No latest revision", "recipe", recipe.ID)
+			return nil
+		}
+
+		if !tools.TimeWindow.Revision(rev) {
+			return nil
+		}
+
+		// Filter out all the heartbeat messages
+		actionType := rev.Action.Name
+		if actionType == "show-heartbeat" || actionType == "console-log" {
+			return nil
+		}
+
+		url := fmt.Sprintf("%s%d/history/", baseUrl, recipe.ID)
+		return pool.Submit(url, fetchRecord(url, recipe.ID))
+	})
+
+	// wait for all the revision pulling to finish
+	results := pool.Wait()
+
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Process all the data
+	summary := tools.NewTable("id", "revisions", "action", "last_revision", "filter_object_used", "jexl_changes")
+	clauses := tools.NewTable("id", "revision", "date", "change", "old", "new")
+	for _, result := range results {
+		if result.Err != nil {
+			tools.Log.Warn("Error fetching revisions", "url", result.Name, "err", result.Err)
+			continue
+		}
+
+		rec := result.Value.(Record)
+		summary.Add(rec.Id, rec.NumRevisions, rec.Action, rec.LastRevision, rec.FilterObjectUsed, rec.FilterExpressionChanges)
+
+		for _, change := range rec.Changes {
+			date := change.Date
+			if len(date) > 10 {
+				date = date[0:10]
+			}
+
+			for _, c := range change.Clauses {
+				clauses.Add(rec.Id, change.RevisionId, date, string(c.Kind), c.Old, c.New)
+			}
+		}
+	}
+
+	if *changes {
+		return tools.Output(clauses)
+	}
+	return tools.Output(summary)
+}
@@ -0,0 +1,143 @@
+// Package findoverlaps is the find-overlaps command
+package findoverlaps
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// finds enabled recipes whose populations can overlap.  Channel, locale,
+// country, platform and version filters have to have something in common and
+// samples over the same input have to share part of the hash space.  Samples
+// over different inputs pick clients independently so they overlap by the
+// product of their sizes.
+//
+// Targeting comes from approved_revision.filter_object plus whatever of the
+// extra_filter_expression translates into filter objects.  Anything else is
+// ignored so the overlaps reported are the most that's possible.
+var Command = &tools.Command{
+	Name:  "find-overlaps",
+	Short: "report enabled recipes whose populations can overlap",
+	Long: `
+Compares every pair of enabled recipes and prints the ones whose populations
+can overlap, with the share of clients in both and the sample buckets they
+have in common.
+
+Columns: a a_action a_slug b b_action b_slug both_pct smaller_pct shared
+
+Targeting comes from approved_revision.filter_object plus whatever of the
+extra_filter_expression translates into filter objects.  Anything else is
+ignored so the overlaps reported are the most that's possible.
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+type recipe struct {
+	ID         int
+	Action     string
+	Slug       string
+	Population *Population
+}
+
+// filters decodes the revision's filter objects and the ones its extra
+// filter expression translates into
+func filters(id int, rev *tools.Revision) []tools.Filter {
+	onError := tools.DecodeOptions{OnError: func(err error) {
+		tools.Log.Warn("Invalid filter object", "recipe", id, "err", err)
+	}}
+
+	all, _ := rev.Filters(onError)
+	if strings.TrimSpace(rev.ExtraFilterExpression) == "" {
+		return all
+	}
+
+	expr, err := jexl.Parse(rev.ExtraFilterExpression)
+	if err != nil {
+		tools.Log.Warn("Parse error", "recipe", id, "err", err)
+		return all
+	}
+
+	translated := tools.Revision{ID: rev.ID, FilterObject: jexl.Translate(expr).FilterObjects}
+	extra, _ := translated.Filters(onError)
+	return append(all, extra...)
+}
+
+func run(ctx context.Context, args []string) error {
+	var recipes []*recipe
+	baseUrl := tools.RecipeURL()
+	err := tools.WalkRecipes(ctx, baseUrl, tools.Lenient, func(r *tools.Recipe) error {
+		// clients get the approved revision, a pending draft doesn't change
+		// who is enrolled.  Fall back to the latest for recipes that never
+		// needed approval.
+		rev := r.ApprovedRevision
+		if rev == nil {
+			rev = r.LatestRevision
+		}
+		if rev == nil {
+			tools.Log.Warn("No revision", "recipe", r.ID)
+			return nil
+		}
+
+		if !rev.Enabled || rev.Action.Name == "console-log" {
+			return nil
+		}
+
+		recipes = append(recipes, &recipe{
+			ID:         r.ID,
+			Action:     rev.Action.Name,
+			Slug:       rev.Arguments.Slug,
+			Population: NewPopulation(r.ID, filters(r.ID, rev)),
+		})
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(recipes, func(i, j int) bool { return recipes[i].ID < recipes[j].ID })
+
+	table := tools.NewTable("a", "a_action", "a_slug", "b", "b_action", "b_slug", "both_pct", "smaller_pct", "shared")
+	for i, a := range recipes {
+		for _, b := range recipes[i+1:] {
+			overlap := a.Population.Overlap(b.Population)
+			if overlap == nil {
+				continue
+			}
+
+			smaller := a.Population.Fraction()
+			if f := b.Population.Fraction(); f < smaller {
+				smaller = f
+			}
+
+			keys := make([]string, 0, len(overlap.Shared))
+			for key := range overlap.Shared {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+
+			shared := make([]string, len(keys))
+			for i, key := range keys {
+				shared[i] = fmt.Sprintf("%s buckets %s of %d", key, formatSpans(overlap.Shared[key]), tools.NamespaceBuckets)
+			}
+
+			table.Add(a.ID, a.Action, a.Slug, b.ID, b.Action, b.Slug,
+				percent(overlap.Fraction), percent(overlap.Fraction/smaller), strings.Join(shared, "; "))
+		}
+	}
+	return tools.Output(table)
+}
+
+// percent is a fraction as a percentage rounded to 2 decimals
+func percent(f float64) float64 {
+	return math.Round(f*10000) / 100
+}
@@ -0,0 +1,262 @@
+package findoverlaps
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// span is a part of the hash space, from lo up to hi, both 0 to 1
+type span struct {
+	lo, hi float64
+}
+
+// Population is who a recipe targets as far as its filter objects say.  A
+// nil list means anyone.  Samples are keyed by their hash input, samples with
+// different inputs pick clients independently.
+type Population struct {
+	Channels  []string
+	Locales   []string
+	Countries []string
+	Platforms []string
+	Versions  []tools.Filter // *tools.VersionFilter or *tools.VersionRangeFilter
+	Samples   map[string][]span
+}
+
+// NewPopulation combines the filters of a recipe.  Filters that can't be
+// reasoned about, ie: negate and presets, are left out so the population is
+// never smaller than the real one.
+func NewPopulation(recipeID int, filters []tools.Filter) *Population {
+	p := &Population{Samples: make(map[string][]span)}
+
+	for _, filter := range filters {
+		switch f := filter.(type) {
+		case *tools.ChannelFilter:
+			p.Channels = intersect(p.Channels, f.Channels)
+		case *tools.LocaleFilter:
+			p.Locales = intersect(p.Locales, f.Locales)
+		case *tools.CountryFilter:
+			p.Countries = intersect(p.Countries, f.Countries)
+		case *tools.PlatformFilter:
+			p.Platforms = intersect(p.Platforms, f.Platforms)
+		case *tools.VersionFilter, *tools.VersionRangeFilter:
+			p.Versions = append(p.Versions, f)
+		case *tools.BucketSampleFilter:
+			p.sample(inputKey(recipeID, f.Input), buckets(f.Start, f.Count, f.Total))
+		case *tools.StableSampleFilter:
+			p.sample(inputKey(recipeID, f.Input), []span{{0, f.Rate}})
+		case *tools.NamespaceSampleFilter:
+			p.sample(namespaceKey(f.Namespace), buckets(f.Start, f.Count, tools.NamespaceBuckets))
+		}
+	}
+
+	return p
+}
+
+// sample adds a sample, a client has to be in every sample of the same input
+func (p *Population) sample(key string, spans []span) {
+	if have, ok := p.Samples[key]; ok {
+		spans = intersectSpans(have, spans)
+	}
+	p.Samples[key] = spans
+}
+
+// Fraction is how much of the clients matching the other filters are sampled
+func (p *Population) Fraction() float64 {
+	f := 1.0
+	for _, spans := range p.Samples {
+		f *= measure(spans)
+	}
+	return f
+}
+
+// Overlap is what two populations have in common
+type Overlap struct {
+	// Fraction is the share of clients, matching both recipes' other
+	// filters, that both recipes sample
+	Fraction float64
+
+	// Shared are the parts of the hash space both recipes sample, for the
+	// samples that use the same input
+	Shared map[string][]span
+}
+
+// Overlap returns what p and o have in common, or nil when no client can be
+// in both
+func (p *Population) Overlap(o *Population) *Overlap {
+	for _, lists := range [][2][]string{
+		{p.Channels, o.Channels},
+		{p.Locales, o.Locales},
+		{p.Countries, o.Countries},
+		{p.Platforms, o.Platforms},
+	} {
+		if lists[0] != nil && lists[1] != nil && len(intersect(lists[0], lists[1])) == 0 {
+			return nil
+		}
+	}
+
+	for _, a := range p.Versions {
+		for _, b := range o.Versions {
+			if !versionsOverlap(a, b) {
+				return nil
+			}
+		}
+	}
+
+	overlap := &Overlap{Fraction: 1, Shared: make(map[string][]span)}
+	for key, spans := range p.Samples {
+		if other, ok := o.Samples[key]; ok {
+			spans = intersectSpans(spans, other)
+			if len(spans) == 0 {
+				return nil
+			}
+			overlap.Shared[key] = spans
+		}
+		overlap.Fraction *= measure(spans)
+	}
+
+	for key, spans := range o.Samples {
+		if _, ok := p.Samples[key]; !ok {
+			overlap.Fraction *= measure(spans)
+		}
+	}
+
+	if overlap.Fraction == 0 {
+		return nil
+	}
+	return overlap
+}
+
+// inputKey is the hash input of a sample.  normandy.recipe.id is replaced
+// with the recipe's id as it's different for every recipe.
+func inputKey(recipeID int, input []string) string {
+	parts := make([]string, len(input))
+	for i, src := range input {
+		if n, err := jexl.Normalize(src); err == nil {
+			src = n
+		}
+		if src == "normandy.recipe.id" {
+			src = strconv.Itoa(recipeID)
+		}
+		parts[i] = src
+	}
+	return "[" + strings.Join(parts, ", ") + "]"
+}
+
+// namespaceKey is the hash input of a namespace sample
+func namespaceKey(namespace string) string {
+	return "[" + jexl.Quote(namespace) + ", normandy.userId]"
+}
+
+// buckets turns count buckets from start, wrapping at total, into spans
+func buckets(start, count, total float64) []span {
+	if total <= 0 || count <= 0 {
+		return nil
+	}
+	if count >= total {
+		return []span{{0, 1}}
+	}
+
+	for start >= total {
+		start -= total
+	}
+
+	lo := start / total
+	hi := (start + count) / total
+	if hi > 1 {
+		return []span{{0, hi - 1}, {lo, 1}}
+	}
+	return []span{{lo, hi}}
+}
+
+func intersectSpans(a, b []span) []span {
+	var out []span
+	for _, x := range a {
+		for _, y := range b {
+			lo, hi := x.lo, x.hi
+			if y.lo > lo {
+				lo = y.lo
+			}
+			if y.hi < hi {
+				hi = y.hi
+			}
+			if lo < hi {
+				out = append(out, span{lo, hi})
+			}
+		}
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].lo < out[j].lo })
+	return out
+}
+
+func measure(spans []span) float64 {
+	total := 0.0
+	for _, s := range spans {
+		total += s.hi - s.lo
+	}
+	return total
+}
+
+// formatSpans shows spans as buckets out of NamespaceBuckets
+func formatSpans(spans []span) string {
+	parts := make([]string, len(spans))
+	for i, s := range spans {
+		parts[i] = fmt.Sprintf("%g-%g", s.lo*tools.NamespaceBuckets, s.hi*tools.NamespaceBuckets)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// intersect returns the values in both lists, nil is every value
+func intersect(a, b []string) []string {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	in := make(map[string]bool, len(b))
+	for _, v := range b {
+		in[v] = true
+	}
+
+	out := []string{}
+	for _, v := range a {
+		if in[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// versionBounds is the range of versions a version filter covers, as
+// [min, max) pairs
+func versionBounds(f tools.Filter) [][2]string {
+	switch f := f.(type) {
+	case *tools.VersionFilter:
+		bounds := make([][2]string, len(f.Versions))
+		for i, v := range f.Versions {
+			bounds[i] = [2]string{fmt.Sprintf("%d.!", v), fmt.Sprintf("%d.*", v)}
+		}
+		return bounds
+	case *tools.VersionRangeFilter:
+		return [][2]string{{f.MinVersion, f.MaxVersion}}
+	}
+	return nil
+}
+
+func versionsOverlap(a, b tools.Filter) bool {
+	for _, x := range versionBounds(a) {
+		for _, y := range versionBounds(b) {
+			if tools.CompareVersions(x[0], y[1]) < 0 && tools.CompareVersions(y[0], x[1]) < 0 {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+// Package list is the list command: recipes by the date of their latest
+// revision.
+package list
+
+import (
+	"context"
+	"flag"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+var Command = &tools.Command{
+	Name:  "list",
+	Short: "list recipes by the date of their latest revision",
+	Long: `
+Lists every recipe ordered by its latest revision.
+
+Columns: date id action slug
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+func run(ctx context.Context, args []string) error {
+	baseUrl := tools.RecipeURL()
+	next := baseUrl + "?ordering=latest_revision"
+
+	table := tools.NewTable("date", "id", "action", "slug")
+	err := tools.WalkRecipes(ctx, next, tools.Lenient, func(recipe *tools.Recipe) error {
+		rev := recipe.LatestRevision
+		if rev == nil || len(rev.DateCreated) < 10 {
+			tools.Log.Warn("No latest revision", "recipe", recipe.ID)
+			return nil
+		}
+
+		if !tools.TimeWindow.Revision(rev) {
+			return nil
+		}
+
+		table.Add(rev.DateCreated[0:10], recipe.ID, rev.Action.Name, rev.Arguments.Slug)
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+	return tools.Output(table)
+}
@@ -0,0 +1,80 @@
+// Package matchclient is the match-client command
+package matchclient
+
+import (
+	"context"
+	"flag"
+
+	"github.com/mostlygeek/normandy-tools/jexl"
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// lists the enabled recipes that would target a client described in a JSON
+// file, see README.md for what goes in it.  Filter objects and filter
+// expressions are evaluated offline, sampling hashes the same way Firefox does.
+var Command = &tools.Command{
+	Name:  "match-client",
+	Usage: "-client <file> [flags]",
+	Short: "list the enabled recipes a described client would get",
+	Long: `
+Lists the enabled recipes that would target the client described in a JSON
+file.
+
+Columns: id action slug
+
+Filter objects and filter expressions are evaluated offline, sampling hashes
+the same way Firefox does.  See README.md for what goes in the client file.
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		clientFile := fs.String("client", "", "JSON file describing the client")
+		return func(ctx context.Context, args []string) error {
+			if *clientFile == "" {
+				return tools.Usagef("-client is required")
+			}
+			return run(ctx, *clientFile)
+		}
+	},
+}
+
+func run(ctx context.Context, clientFile string) error {
+	client, err := jexl.LoadClient(clientFile)
+	if err != nil {
+		return err
+	}
+
+	table := tools.NewTable("id", "action", "slug")
+
+	baseUrl := tools.RecipeURL()
+	err = tools.WalkRecipes(ctx, baseUrl, tools.Lenient, func(recipe *tools.Recipe) error {
+		// clients get the approved revision, fall back to the latest for
+		// recipes that never needed approval
+		rev := recipe.ApprovedRevision
+		if rev == nil {
+			rev = recipe.LatestRevision
+		}
+		if rev == nil {
+			tools.Log.Warn("No revision", "recipe", recipe.ID)
+			return nil
+		}
+
+		if !rev.Enabled {
+			return nil
+		}
+
+		match, err := client.Matches(recipe.ID, rev)
+		if err != nil {
+			tools.Log.Warn("Eval error", "recipe", recipe.ID, "err", err)
+			return nil
+		}
+
+		if match {
+			table.Add(recipe.ID, rev.Action.Name, rev.Arguments.Slug)
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+	return tools.Output(table)
+}
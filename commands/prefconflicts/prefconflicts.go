@@ -0,0 +1,124 @@
+// Package prefconflicts is the pref-conflicts command
+package prefconflicts
+
+import (
+	"context"
+	"flag"
+	"sort"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// reports preferences that more than one enabled recipe sets.  Different
+// values conflict outright, but even the same value clashes: whichever recipe
+// unenrolls first resets the pref for the other.  Looks at the arguments of
+// preference-experiment, multi-preference-experiment and preference-rollout
+// recipes, so a rollout setting a pref an experiment is testing shows up too.
+var Command = &tools.Command{
+	Name:  "pref-conflicts",
+	Short: "report prefs that more than one enabled recipe sets",
+	Long: `
+Lists preferences that more than one enabled recipe sets.  status is
+CONFLICT when they set different values or on different branches and SHARED
+when they set the same value, which still clashes: whichever recipe is
+unenrolled first resets the pref for the other.  Looks at
+preference-experiment, multi-preference-experiment and preference-rollout
+recipes, so a rollout setting a pref an experiment is testing shows up too.
+
+The approved revision is what clients run, a pending draft doesn't count.
+
+Columns: pref status recipe action slug branch branch_type value
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		all = fs.Bool("all", false, "show every pref set by a live recipe, not only the ones set by more than one")
+		return run
+	},
+}
+
+var all *bool
+
+type setting struct {
+	tools.PreferenceSetting
+	RecipeID int
+	Action   string
+	Slug     string
+}
+
+// statuses of a pref, from worst to best
+const (
+	Conflict = "CONFLICT"
+	Shared   = "SHARED"
+	OK       = "ok"
+)
+
+// status is Conflict when settings from different recipes disagree on the
+// value or on which branch the pref is set on, Shared when different recipes
+// set it the same way and OK when only one recipe sets it
+func status(settings []setting) string {
+	result := OK
+	for i, a := range settings {
+		for _, b := range settings[i+1:] {
+			if a.RecipeID == b.RecipeID {
+				continue
+			}
+			if a.Value != b.Value || a.BranchType != b.BranchType {
+				return Conflict
+			}
+			result = Shared
+		}
+	}
+	return result
+}
+
+func run(ctx context.Context, args []string) error {
+	prefs := make(map[string][]setting)
+
+	baseUrl := tools.RecipeURL()
+	err := tools.WalkRecipes(ctx, baseUrl, tools.Lenient, func(recipe *tools.Recipe) error {
+		// clients get the approved revision, fall back to the latest for
+		// recipes that never needed approval
+		rev := recipe.ApprovedRevision
+		if rev == nil {
+			rev = recipe.LatestRevision
+		}
+		if rev == nil {
+			tools.Log.Warn("No revision", "recipe", recipe.ID)
+			return nil
+		}
+
+		if !rev.Enabled {
+			return nil
+		}
+
+		for _, s := range rev.PreferenceSettings() {
+			prefs[s.Pref] = append(prefs[s.Pref], setting{s, recipe.ID, rev.Action.Name, rev.Arguments.Slug})
+		}
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, 0, len(prefs))
+	for name := range prefs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	table := tools.NewTable("pref", "status", "recipe", "action", "slug", "branch", "branch_type", "value")
+	for _, name := range names {
+		settings := prefs[name]
+		sort.SliceStable(settings, func(i, j int) bool { return settings[i].RecipeID < settings[j].RecipeID })
+
+		state := status(settings)
+		if state == OK && !*all {
+			continue
+		}
+
+		for _, s := range settings {
+			table.Add(s.Pref, state, s.RecipeID, s.Action, s.Slug, s.Branch, s.BranchType, s.Value)
+		}
+	}
+	return tools.Output(table)
+}
@@ -0,0 +1,39 @@
+package prefconflicts
+
+import (
+	"testing"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+func TestStatus(t *testing.T) {
+	set := func(recipe int, branchType, value string) setting {
+		return setting{
+			PreferenceSetting: tools.PreferenceSetting{Pref: "p", BranchType: branchType, Value: value},
+			RecipeID:          recipe,
+		}
+	}
+
+	tests := []struct {
+		name     string
+		settings []setting
+		want     string
+	}{
+		{"one recipe", []setting{set(1, "default", "true")}, OK},
+		{"branches of one recipe", []setting{set(1, "default", "true"), set(1, "default", "false")}, OK},
+		{"same value", []setting{set(1, "default", "true"), set(2, "default", "true")}, Shared},
+		{"different value", []setting{set(1, "default", "true"), set(2, "default", "false")}, Conflict},
+		{"different branch type", []setting{set(1, "default", "true"), set(2, "user", "true")}, Conflict},
+		{
+			"conflict after shared",
+			[]setting{set(1, "default", "true"), set(2, "default", "true"), set(3, "default", "1")},
+			Conflict,
+		},
+	}
+
+	for _, test := range tests {
+		if got := status(test.settings); got != test.want {
+			t.Errorf("%s: status = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
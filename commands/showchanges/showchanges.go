@@ -0,0 +1,226 @@
+// Package showchanges is the show-changes command
+package showchanges
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// This outputs a list of information with:
+// - first revision, last revision
+// - days live, how many times it was launched and its longest run
+// - is the recipe live?
+// - recipe id, type and slug
+//
+// Days live only counts the time the recipe was enabled, pauses in between
+// aren't live time.  With -timeline each enabled or disabled stretch is listed
+// instead.
+//
+// this information is useful for getting a high level view of what's currently
+// live in production.  Also useful to see what has ended, when it ended, etc.
+var Command = &tools.Command{
+	Name:  "show-changes",
+	Short: "show when recipes were first and last changed and how long they were live",
+	Long: `
+Prints a line for every recipe with its revision history summarized.
+
+Columns: id action slug live first_revision last_revision days_live launches longest_run_days revisions timeline
+
+days_live is the total time the recipe was enabled, until now if it still is.
+Time it spent paused doesn't count.  launches is how many times it went from
+disabled to enabled and longest_run_days its longest stretch enabled without a
+pause.  timeline draws the recipe's history from the first revision in the
+report until now: # enabled, - disabled.
+
+When a recipe was enabled and disabled comes from its revisions'
+enabled_states, revisions without any, like drafts, don't change it.  If no
+revision has enabled_states each one counts from when it was made.
+
+With -snapshot, now is when the snapshot was made.
+
+With -timeline there's a line for every stretch of time a recipe was enabled or
+disabled instead.  end is empty while it lasts.
+
+Columns: id action slug state start end days
+
+Useful for a high level view of what's currently live in production and to
+see what has ended and when.  console-log recipes are skipped.
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		timeline = fs.Bool("timeline", false, "list when each recipe was enabled and disabled instead of a line per recipe")
+		return run
+	},
+}
+
+var timeline *bool
+
+// timelineWidth is how many characters the timeline column is
+const timelineWidth = 40
+
+type Record struct {
+	Id        int
+	Action    string
+	Slug      string
+	Revisions int
+	First     string
+	Last      string
+	Timeline  tools.Timeline
+}
+
+// fetchRevisions returns a task that fills in record's revision history
+func fetchRevisions(url string, record Record, now time.Time) tools.Task {
+	return func(ctx context.Context) (interface{}, error) {
+		body, err := tools.GetContext(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		history, err := tools.DecodeHistory(body, tools.Lenient)
+		if err != nil {
+			return nil, err
+		}
+
+		record.Revisions = len(history)
+		record.Timeline = tools.NewTimeline(history, now)
+		if len(record.Timeline) > 0 {
+			record.First = date(record.Timeline[0].Start)
+			record.Last = date(lastRevision(history))
+		}
+
+		return record, nil
+	}
+}
+
+// lastRevision is when the newest revision was made, it can be later than the
+// start of the last interval when it didn't enable or disable the recipe
+func lastRevision(history []tools.Revision) time.Time {
+	var latest int64
+	for _, revision := range history {
+		if ts := tools.RFC3339ToUnix(revision.DateCreated); ts > latest {
+			latest = ts
+		}
+	}
+	return time.Unix(latest, 0)
+}
+
+func date(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+func days(d time.Duration) int64 {
+	return int64(d / (24 * time.Hour))
+}
+
+func run(ctx context.Context, args []string) error {
+	baseUrl := tools.RecipeURL()
+
+	// durations of live recipes are as of when the snapshot was made
+	now := time.Now()
+	if s := tools.CurrentSnapshot(); s != nil {
+		now = s.Created
+	}
+
+	// lots of workers to load and process data fast
+	pool := tools.NewPool(ctx, tools.Workers)
+
+	err := tools.WalkRecipes(ctx, baseUrl+"?ordering=-id", tools.Lenient, func(recipe *tools.Recipe) error {
+		id := recipe.ID
+		rev := recipe.LatestRevision
+		if rev == nil {
+			tools.Log.Warn("No latest revision", "recipe", id)
+			return nil
+		}
+
+		if !tools.TimeWindow.Revision(rev) {
+			return nil
+		}
+
+		action := rev.Action.Name
+		slug := rev.Arguments.Slug
+
+		// Filter out unwanted types
+		switch action {
+		case "console-log":
+			return nil
+		default:
+			// created the record, the pool fills in the revisions
+			record := Record{Id: id, Action: action, Slug: slug}
+			url := fmt.Sprintf("%s%d/history/", baseUrl, id)
+			return pool.Submit(url, fetchRevisions(url, record, now))
+		}
+	})
+
+	// wait for all the revision pulling to finish
+	results := pool.Wait()
+
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var records []Record
+	for _, result := range results {
+		if result.Err != nil {
+			tools.Log.Warn("Error fetching revisions", "url", result.Name, "err", result.Err)
+			continue
+		}
+
+		rec := result.Value.(Record)
+		if len(rec.Timeline) == 0 {
+			tools.Log.Warn("No revisions", "recipe", rec.Id)
+			continue
+		}
+		records = append(records, rec)
+	}
+
+	if *timeline {
+		return tools.Output(intervals(records))
+	}
+
+	// every recipe's timeline is drawn on the same scale
+	from := now
+	for _, rec := range records {
+		if start := rec.Timeline[0].Start; start.Before(from) {
+			from = start
+		}
+	}
+
+	// Process all the data
+	table := tools.NewTable("id", "action", "slug", "live", "first_revision", "last_revision",
+		"days_live", "launches", "longest_run_days", "revisions", "timeline")
+	for _, rec := range records {
+		t := rec.Timeline
+		table.Add(rec.Id, rec.Action, rec.Slug, t.Live(), rec.First, rec.Last,
+			days(t.LiveTime()), t.Launches(), days(t.LongestRun()), rec.Revisions,
+			t.Render(from, now, timelineWidth))
+	}
+
+	return tools.Output(table)
+}
+
+// intervals lists every stretch of time the recipes were enabled or disabled
+func intervals(records []Record) *tools.Table {
+	table := tools.NewTable("id", "action", "slug", "state", "start", "end", "days")
+	for _, rec := range records {
+		for _, i := range rec.Timeline {
+			state := "disabled"
+			if i.Enabled {
+				state = "enabled"
+			}
+
+			var end interface{}
+			if !i.Ongoing {
+				end = date(i.End)
+			}
+
+			table.Add(rec.Id, rec.Action, rec.Slug, state, date(i.Start), end, days(i.Duration()))
+		}
+	}
+	return table
+}
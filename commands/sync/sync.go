@@ -0,0 +1,173 @@
+// Package sync is the sync command
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/mostlygeek/normandy-tools/tools"
+	"github.com/pkg/errors"
+)
+
+// saves every recipe and its revision history into a new snapshot in the
+// local store.  Histories are only fetched for recipes whose latest_revision
+// changed since the last snapshot, the rest are copied over.
+var Command = &tools.Command{
+	Name:  "sync",
+	Short: "save every recipe and its history to a snapshot in the local store",
+	Long: `
+Saves every recipe and its full revision history as a new snapshot in the
+local store (-store).  Snapshots are kept, one JSONL file per sync, so older
+ones can still be read and compared.
+
+Only recipes whose latest_revision changed since the last snapshot have their
+history fetched again, the rest are copied from it.
+
+Any command can then read from a snapshot instead of the server with
+-snapshot latest, -snapshot 2020-07-02 (the last snapshot from before then)
+or -snapshot <file>.
+
+Columns: snapshot recipes added changed unchanged removed
+`,
+	Setup: func(fs *flag.FlagSet) func(context.Context, []string) error {
+		return run
+	},
+}
+
+// history is a fetched history and where it goes in the snapshot
+type history struct {
+	index int
+	body  json.RawMessage
+}
+
+func fetchHistory(url string, index int) tools.Task {
+	return func(ctx context.Context) (interface{}, error) {
+		body, err := tools.GetContext(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+
+		// only keep histories the report commands can read
+		if _, err := tools.DecodeHistory(body, tools.Lenient); err != nil {
+			return nil, err
+		}
+		return history{index, body}, nil
+	}
+}
+
+func run(ctx context.Context, args []string) error {
+	if tools.CurrentSnapshot() != nil {
+		return tools.Usagef("sync reads from the server, it can't be used with -snapshot")
+	}
+
+	store := tools.CurrentStore()
+
+	var previous *tools.Snapshot
+	if info, err := store.Find("latest", time.Now()); err == nil {
+		if previous, err = tools.LoadSnapshot(info.Path); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, tools.ErrNoSnapshots) {
+		return err
+	}
+
+	// the snapshot has to be current, revalidating cached responses is
+	// cheap when they didn't change
+	if !tools.CacheOffline {
+		tools.CacheRefresh = true
+	}
+
+	started := time.Now()
+	baseUrl := tools.RecipeURL()
+	pool := tools.NewPool(ctx, tools.Workers)
+
+	var recipes []tools.StoredRecipe
+	var added, changed, unchanged int
+	err := tools.WalkAPIParallel(ctx, baseUrl, tools.Workers, func(record []byte) error {
+		id, err := jsonparser.GetInt(record, "id")
+		if err != nil {
+			return errors.Wrap(err, "Recipe without an id")
+		}
+
+		r := tools.StoredRecipe{ID: int(id), Recipe: append(json.RawMessage(nil), record...)}
+		if old := previousRecipe(previous, r.ID); old == nil {
+			added++
+		} else if !bytes.Equal(old.LatestRevision(), r.LatestRevision()) {
+			changed++
+		} else {
+			r.History = old.History
+			unchanged++
+		}
+
+		recipes = append(recipes, r)
+		if r.History != nil {
+			return nil
+		}
+
+		url := fmt.Sprintf("%s%d/history/", baseUrl, id)
+		return pool.Submit(url, fetchHistory(url, len(recipes)-1))
+	})
+
+	results := pool.Wait()
+
+	if errors.Is(err, tools.ErrPagesShifted) {
+		return errors.Wrap(err, "Recipes changed while syncing, run sync again")
+	} else if err != nil {
+		return err
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
+			tools.Log.Warn("Error fetching revisions", "url", result.Name, "err", result.Err)
+			failed++
+			continue
+		}
+
+		h := result.Value.(history)
+		recipes[h.index].History = h.body
+	}
+
+	// a snapshot missing histories would look like recipes with no changes
+	if failed > 0 {
+		return errors.Errorf("%d histories could not be fetched, no snapshot saved", failed)
+	}
+
+	removed := 0
+	if previous != nil {
+		seen := make(map[int]bool, len(recipes))
+		for _, r := range recipes {
+			seen[r.ID] = true
+		}
+		for _, r := range previous.Recipes {
+			if !seen[r.ID] {
+				removed++
+			}
+		}
+	}
+
+	path, err := store.Save(recipes, tools.CurrentEnvironment().BaseURL, started)
+	if err != nil {
+		return err
+	}
+
+	table := tools.NewTable("snapshot", "recipes", "added", "changed", "unchanged", "removed")
+	table.Add(path, len(recipes), added, changed, unchanged, removed)
+	return tools.Output(table)
+}
+
+func previousRecipe(previous *tools.Snapshot, id int) *tools.StoredRecipe {
+	if previous == nil {
+		return nil
+	}
+	return previous.Recipe(id)
+}
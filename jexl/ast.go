@@ -0,0 +1,305 @@
+package jexl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node is an element of a parsed expression.  String returns the expression
+// as JEXL source in a normalized form: same spacing, double quoted strings
+// and only the parentheses that are needed.
+type Node interface {
+	Pos() Pos
+	String() string
+}
+
+// Literal is a string, number (float64), boolean or null (nil)
+type Literal struct {
+	At    Pos
+	Value interface{}
+}
+
+// Identifier is a name, optionally looked up on another node:
+// normandy.channel is Identifier{Name: "channel", From: Identifier{Name: "normandy"}}.
+// Relative identifiers (.foo) are only found inside filters.
+type Identifier struct {
+	At       Pos
+	Name     string
+	From     Node
+	Relative bool
+}
+
+// Unary is a prefix operator: ! or -
+type Unary struct {
+	At      Pos
+	Op      string
+	Operand Node
+}
+
+// Binary is an infix operator, including "in"
+type Binary struct {
+	At    Pos
+	Op    string
+	Left  Node
+	Right Node
+}
+
+// Conditional is the ternary operator: Test ? Consequent : Alternate
+type Conditional struct {
+	At         Pos
+	Test       Node
+	Consequent Node
+	Alternate  Node
+}
+
+// Transform is Subject|Name(Args...), ie: normandy.version|versionCompare("78.0")
+type Transform struct {
+	At      Pos
+	Name    string
+	Subject Node
+	Args    []Node
+}
+
+// Filter is Subject[Expr], either an index (foo[0], foo["bar"]) or a filter
+// using relative identifiers (foo[.bar == 1])
+type Filter struct {
+	At      Pos
+	Subject Node
+	Expr    Node
+}
+
+// Array is a list literal: [a, b]
+type Array struct {
+	At       Pos
+	Elements []Node
+}
+
+// Object is an object literal: {a: 1, "b c": 2}
+type Object struct {
+	At      Pos
+	Entries []ObjectEntry
+}
+
+type ObjectEntry struct {
+	Key   string
+	Value Node
+}
+
+func (n *Literal) Pos() Pos     { return n.At }
+func (n *Identifier) Pos() Pos  { return n.At }
+func (n *Unary) Pos() Pos       { return n.At }
+func (n *Binary) Pos() Pos      { return n.At }
+func (n *Conditional) Pos() Pos { return n.At }
+func (n *Transform) Pos() Pos   { return n.At }
+func (n *Filter) Pos() Pos      { return n.At }
+func (n *Array) Pos() Pos       { return n.At }
+func (n *Object) Pos() Pos      { return n.At }
+
+// binaryPrecedence matches mozjexl's grammar.  Note && and || have the
+// same precedence, a || b && c is (a || b) && c.
+var binaryPrecedence = map[string]int{
+	"||": 10, "&&": 10,
+	"==": 20, "!=": 20, ">": 20, ">=": 20, "<": 20, "<=": 20, "in": 20,
+	"+": 30, "-": 30,
+	"*": 40, "/": 40, "//": 40, "%": 40,
+	"^": 50,
+}
+
+const (
+	precConditional = 0
+	precUnary       = 100
+	precOperand     = 200 // literals, identifiers, transforms, etc
+)
+
+func precedence(n Node) int {
+	switch n := n.(type) {
+	case *Conditional:
+		return precConditional
+	case *Binary:
+		return binaryPrecedence[n.Op]
+	case *Unary:
+		return precUnary
+	}
+	return precOperand
+}
+
+// wrap puts parentheses around n when its precedence is below min
+func wrap(n Node, min int) string {
+	if precedence(n) < min {
+		return "(" + n.String() + ")"
+	}
+	return n.String()
+}
+
+// Quote returns s as a double quoted JEXL string
+func Quote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`, "\r", `\r`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func (n *Literal) String() string {
+	switch v := n.Value.(type) {
+	case string:
+		return Quote(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case nil:
+		return "null"
+	}
+	return "null"
+}
+
+func (n *Identifier) String() string {
+	switch {
+	case n.Relative:
+		return "." + n.Name
+	case n.From != nil:
+		return wrap(n.From, precOperand) + "." + n.Name
+	}
+	return n.Name
+}
+
+// Path is the dotted name of an identifier chain, ie: normandy.telemetry.main,
+// or "" when the chain has something other than identifiers in it
+func (n *Identifier) Path() string {
+	if n.Relative {
+		return ""
+	}
+	if n.From == nil {
+		return n.Name
+	}
+	if from, ok := n.From.(*Identifier); ok {
+		if p := from.Path(); p != "" {
+			return p + "." + n.Name
+		}
+	}
+	return ""
+}
+
+func (n *Unary) String() string {
+	return n.Op + wrap(n.Operand, precUnary)
+}
+
+func (n *Binary) String() string {
+	prec := binaryPrecedence[n.Op]
+
+	// left associative, the right side needs parentheses at the same level
+	return wrap(n.Left, prec) + " " + n.Op + " " + wrap(n.Right, prec+1)
+}
+
+func (n *Conditional) String() string {
+	return wrap(n.Test, precConditional+1) + " ? " + n.Consequent.String() + " : " + n.Alternate.String()
+}
+
+func (n *Transform) String() string {
+	s := wrap(n.Subject, precOperand) + "|" + n.Name
+	if len(n.Args) > 0 {
+		s += "(" + joinNodes(n.Args) + ")"
+	}
+	return s
+}
+
+func (n *Filter) String() string {
+	return wrap(n.Subject, precOperand) + "[" + n.Expr.String() + "]"
+}
+
+func (n *Array) String() string {
+	return "[" + joinNodes(n.Elements) + "]"
+}
+
+func (n *Object) String() string {
+	parts := make([]string, len(n.Entries))
+	for i, e := range n.Entries {
+		parts[i] = Quote(e.Key) + ": " + e.Value.String()
+	}
+	return "{" + strings.Join(parts, ", ") + "}"
+}
+
+func joinNodes(nodes []Node) string {
+	parts := make([]string, len(nodes))
+	for i, n := range nodes {
+		parts[i] = n.String()
+	}
+	return strings.Join(parts, ", ")
+}
+
+// Walk calls fn for n and every node below it, depth first.  Children are
+// skipped when fn returns false.
+func Walk(n Node, fn func(Node) bool) {
+	if n == nil || !fn(n) {
+		return
+	}
+
+	switch n := n.(type) {
+	case *Identifier:
+		Walk(n.From, fn)
+	case *Unary:
+		Walk(n.Operand, fn)
+	case *Binary:
+		Walk(n.Left, fn)
+		Walk(n.Right, fn)
+	case *Conditional:
+		Walk(n.Test, fn)
+		Walk(n.Consequent, fn)
+		Walk(n.Alternate, fn)
+	case *Transform:
+		Walk(n.Subject, fn)
+		for _, a := range n.Args {
+			Walk(a, fn)
+		}
+	case *Filter:
+		Walk(n.Subject, fn)
+		Walk(n.Expr, fn)
+	case *Array:
+		for _, e := range n.Elements {
+			Walk(e, fn)
+		}
+	case *Object:
+		for _, e := range n.Entries {
+			Walk(e.Value, fn)
+		}
+	}
+}
+
+// References returns the sorted, unique context paths used by n,
+// ie: normandy.channel, normandy.telemetry.main.environment
+func References(n Node) []string {
+	seen := make(map[string]bool)
+	Walk(n, func(n Node) bool {
+		if id, ok := n.(*Identifier); ok {
+			if p := id.Path(); p != "" {
+				seen[p] = true
+				return false // the rest of the chain is a prefix
+			}
+		}
+		return true
+	})
+
+	refs := make([]string, 0, len(seen))
+	for r := range seen {
+		refs = append(refs, r)
+	}
+	sort.Strings(refs)
+	return refs
+}
+
+// Transforms returns the sorted, unique transform names used by n
+func Transforms(n Node) []string {
+	seen := make(map[string]bool)
+	Walk(n, func(n Node) bool {
+		if t, ok := n.(*Transform); ok {
+			seen[t.Name] = true
+		}
+		return true
+	})
+
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
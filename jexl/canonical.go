@@ -0,0 +1,140 @@
+package jexl
+
+import (
+	"sort"
+	"strings"
+)
+
+// Canonical returns a copy of n rewritten so that expressions that only
+// differ in ways that don't change their meaning come out the same:
+//
+//   - && and || chains are flattened, sorted and have duplicates removed
+//   - the sides of == and != are sorted
+//   - arrays on the right side of "in" are sorted with duplicates removed
+//
+// Compare the String() of canonical nodes to see if two expressions are the
+// same.  Positions are kept from the original nodes.
+func Canonical(n Node) Node {
+	switch n := n.(type) {
+	case *Binary:
+		switch n.Op {
+		case "&&", "||":
+			operands := flatten(n, n.Op)
+			for i, o := range operands {
+				operands[i] = Canonical(o)
+			}
+			return chain(n.At, n.Op, sortUnique(operands))
+
+		case "==", "!=":
+			left, right := Canonical(n.Left), Canonical(n.Right)
+			if right.String() < left.String() {
+				left, right = right, left
+			}
+			return &Binary{At: n.At, Op: n.Op, Left: left, Right: right}
+
+		case "in":
+			right := Canonical(n.Right)
+			if arr, ok := right.(*Array); ok {
+				right = &Array{At: arr.At, Elements: sortUnique(arr.Elements)}
+			}
+			return &Binary{At: n.At, Op: n.Op, Left: Canonical(n.Left), Right: right}
+		}
+
+		return &Binary{At: n.At, Op: n.Op, Left: Canonical(n.Left), Right: Canonical(n.Right)}
+
+	case *Unary:
+		return &Unary{At: n.At, Op: n.Op, Operand: Canonical(n.Operand)}
+
+	case *Conditional:
+		return &Conditional{At: n.At, Test: Canonical(n.Test), Consequent: Canonical(n.Consequent), Alternate: Canonical(n.Alternate)}
+
+	case *Identifier:
+		if n.From == nil {
+			return n
+		}
+		return &Identifier{At: n.At, Name: n.Name, From: Canonical(n.From), Relative: n.Relative}
+
+	case *Transform:
+		args := make([]Node, len(n.Args))
+		for i, a := range n.Args {
+			args[i] = Canonical(a)
+		}
+		return &Transform{At: n.At, Name: n.Name, Subject: Canonical(n.Subject), Args: args}
+
+	case *Filter:
+		return &Filter{At: n.At, Subject: Canonical(n.Subject), Expr: Canonical(n.Expr)}
+
+	case *Array:
+		elements := make([]Node, len(n.Elements))
+		for i, e := range n.Elements {
+			elements[i] = Canonical(e)
+		}
+		return &Array{At: n.At, Elements: elements}
+
+	case *Object:
+		entries := make([]ObjectEntry, len(n.Entries))
+		for i, e := range n.Entries {
+			entries[i] = ObjectEntry{e.Key, Canonical(e.Value)}
+		}
+		sort.SliceStable(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+		return &Object{At: n.At, Entries: entries}
+	}
+
+	return n
+}
+
+// Equal is true when a and b mean the same thing, see Canonical
+func Equal(a, b Node) bool {
+	return Canonical(a).String() == Canonical(b).String()
+}
+
+// Clauses splits n into the operands of its top level && chain.  Normandy
+// joins the filter objects and the extra filter expression with &&, so
+// these are the individual targeting rules of a recipe.
+func Clauses(n Node) []Node {
+	return flatten(n, "&&")
+}
+
+// flatten returns the operands of a chain of op, ie: a && (b && c) is
+// [a, b, c].  Anything that isn't op is a single operand.
+func flatten(n Node, op string) []Node {
+	if b, ok := n.(*Binary); ok && b.Op == op {
+		return append(flatten(b.Left, op), flatten(b.Right, op)...)
+	}
+	return []Node{n}
+}
+
+// chain joins operands back together with op
+func chain(at Pos, op string, operands []Node) Node {
+	n := operands[0]
+	for _, o := range operands[1:] {
+		n = &Binary{At: at, Op: op, Left: n, Right: o}
+	}
+	return n
+}
+
+// sortUnique sorts nodes by their source and removes duplicates
+func sortUnique(nodes []Node) []Node {
+	keyed := make(map[string]Node, len(nodes))
+	keys := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		k := n.String()
+		if _, ok := keyed[k]; !ok {
+			keyed[k] = n
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	out := make([]Node, len(keys))
+	for i, k := range keys {
+		out[i] = keyed[k]
+	}
+	return out
+}
+
+// signature groups clauses that target the same thing, so a changed version
+// number shows up as one modified clause instead of a removed and an added one
+func signature(n Node) string {
+	return strings.Join(References(n), ",") + "|" + strings.Join(Transforms(n), ",")
+}
@@ -0,0 +1,152 @@
+package jexl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`b && a`, `a && b`},
+		{`c && (b && a)`, `a && b && c`},
+		{`a && a && b`, `a && b`},
+		{`b || a`, `a || b`},
+		{`normandy.channel == "release"`, `"release" == normandy.channel`},
+		{`b != a`, `a != b`},
+		{`x in ["b", "a", "b"]`, `x in ["a", "b"]`},
+		{`{b: 1, a: 2}`, `{"a": 2, "b": 1}`},
+
+		// mixed chains are only sorted within each chain, && and || are the
+		// same precedence so the parentheses aren't needed
+		{`(b || a) && c`, `a || b && c`},
+		{`c && (b || a)`, `a || b && c`},
+		{`a || b && c`, `a || b && c`},
+		{`a && (c || b)`, `a && (b || c)`},
+
+		// order matters for these
+		{`b - a`, `b - a`},
+		{`b > a`, `b > a`},
+		{`x - ["b", "a"]`, `x - ["b", "a"]`},
+		{`a|t(2, 1)`, `a|t(2, 1)`},
+
+		// nested expressions are canonical too
+		{`!(b && a)`, `!(a && b)`},
+		{`list[.b && .a]`, `list[.a && .b]`},
+		{`c ? b && a : 1 == x`, `c ? a && b : 1 == x`},
+		{`[b && a]|t(d || c)`, `[a && b]|t(c || d)`},
+	}
+
+	for _, test := range tests {
+		if got := Canonical(MustParse(test.src)).String(); got != test.want {
+			t.Errorf("Canonical(%s) = %s, want %s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{`a && b`, `b && a`, true},
+		{`a && (b && c)`, `(c && a) && b`, true},
+		{`a && a`, `a`, true},
+		{`a == 1`, `1 == a`, true},
+		{`x in ["b", "a", "a"]`, `x in ['a', 'b']`, true},
+		{`normandy.version|versionCompare("78.0") >= 0`, `normandy.version | versionCompare('78.0')>=0`, true},
+		{`(a || b) && c`, `c && (b || a)`, true},
+
+		{`a && b`, `a || b`, false},
+		{`a - b`, `b - a`, false},
+		{`a > 1`, `1 > a`, false},
+		{`a && b || c`, `a && (b || c)`, false},
+		{`x == ["a", "b"]`, `x == ["b", "a"]`, false},
+		{`a`, `b`, false},
+		{`"1" == a`, `1 == a`, false},
+	}
+
+	for _, test := range tests {
+		if got := Equal(MustParse(test.a), MustParse(test.b)); got != test.equal {
+			t.Errorf("Equal(%s, %s) = %v, want %v", test.a, test.b, got, test.equal)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	parse := func(src string) Node {
+		if src == "" {
+			return nil
+		}
+		return MustParse(src)
+	}
+
+	tests := []struct {
+		name     string
+		old, new string
+		want     []ClauseChange
+	}{
+		{
+			name: "reordered",
+			old:  `normandy.channel == "release" && normandy.locale == "en-US"`,
+			new:  `normandy.locale == "en-US" && "release" == normandy.channel`,
+		},
+		{
+			name: "version changed",
+			old:  `normandy.channel == "release" && normandy.version >= "70"`,
+			new:  `normandy.version >= "71" && normandy.channel == "release"`,
+			want: []ClauseChange{{Modified, `normandy.version >= "70"`, `normandy.version >= "71"`}},
+		},
+		{
+			name: "clause added",
+			old:  `a`,
+			new:  `a && normandy.country == "CA"`,
+			want: []ClauseChange{{Kind: Added, New: `"CA" == normandy.country`}},
+		},
+		{
+			name: "clause removed",
+			old:  `a && b`,
+			new:  `a`,
+			want: []ClauseChange{{Kind: Removed, Old: `b`}},
+		},
+		{
+			name: "different references aren't paired",
+			old:  `a && b`,
+			new:  `a && c`,
+			want: []ClauseChange{{Kind: Removed, Old: `b`}, {Kind: Added, New: `c`}},
+		},
+		{
+			name: "same reference, different transform",
+			old:  `"p"|preferenceValue == 1`,
+			new:  `"p"|preferenceExists`,
+			want: []ClauseChange{{Kind: Removed, Old: `"p"|preferenceValue == 1`}, {Kind: Added, New: `"p"|preferenceExists`}},
+		},
+		{
+			name: "from empty",
+			new:  `b && a`,
+			want: []ClauseChange{{Kind: Added, New: `a`}, {Kind: Added, New: `b`}},
+		},
+		{
+			name: "to empty",
+			old:  `a`,
+			want: []ClauseChange{{Kind: Removed, Old: `a`}},
+		},
+		{
+			name: "both empty",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := Diff(parse(test.old), parse(test.new))
+			if len(got) == 0 && len(test.want) == 0 {
+				return
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Diff = %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,380 @@
+package jexl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+	"github.com/pkg/errors"
+)
+
+// Client is a simulated Firefox client to check targeting against.  It's the
+// normandy (and older env) context filter expressions see.
+type Client struct {
+	UserID  string `json:"userId"`
+	Version string `json:"version"`
+	Channel string `json:"channel"`
+	Locale  string `json:"locale"`
+	Country string `json:"country"`
+
+	// OS is Firefox's name for the platform: Windows_NT, Darwin or Linux
+	OS string `json:"os"`
+
+	// Telemetry is the latest ping of each type, ie: main, keyed by type
+	Telemetry map[string]interface{} `json:"telemetry"`
+
+	// Preferences are the values of prefs the client has, UserSetPreferences
+	// the names of the ones the user changed
+	Preferences        map[string]interface{} `json:"preferences"`
+	UserSetPreferences []string               `json:"userSetPreferences"`
+
+	// Extra are any other normandy context values, ie: isDefaultBrowser,
+	// searchEngine or distribution
+	Extra map[string]interface{} `json:"extra"`
+
+	// SampleBucket, when set, puts the client in this bucket (0-9999) of
+	// every sample instead of hashing its userId
+	SampleBucket *int `json:"sampleBucket"`
+}
+
+// LoadClient reads a Client from a JSON file
+func LoadClient(path string) (*Client, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed reading client")
+	}
+
+	var c Client
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errors.Wrapf(err, "Failed decoding client %s", path)
+	}
+
+	if c.SampleBucket != nil && (*c.SampleBucket < 0 || *c.SampleBucket >= tools.NamespaceBuckets) {
+		return nil, errors.Errorf("sampleBucket %d is not between 0 and %d", *c.SampleBucket, tools.NamespaceBuckets-1)
+	}
+	return &c, nil
+}
+
+// Evaluator returns an evaluator with the client's context and Normandy's
+// transforms for a recipe
+func (c *Client) Evaluator(recipeID int, arguments json.RawMessage) *Evaluator {
+	var args interface{}
+	if len(arguments) > 0 {
+		json.Unmarshal(arguments, &args)
+	}
+
+	normandy := map[string]interface{}{}
+	for k, v := range c.Extra {
+		normandy[k] = v
+	}
+
+	telemetry := map[string]interface{}{}
+	for k, v := range c.Telemetry {
+		telemetry[k] = v
+	}
+
+	normandy["userId"] = c.UserID
+	normandy["version"] = c.Version
+	normandy["channel"] = c.Channel
+	normandy["locale"] = c.Locale
+	normandy["country"] = c.Country
+	normandy["telemetry"] = telemetry
+	normandy["os"] = map[string]interface{}{
+		"isWindows": c.OS == "Windows_NT",
+		"isMac":     c.OS == "Darwin",
+		"isLinux":   c.OS == "Linux",
+	}
+	normandy["recipe"] = map[string]interface{}{
+		"id":        float64(recipeID),
+		"arguments": args,
+	}
+
+	return &Evaluator{
+		Context: map[string]interface{}{"normandy": normandy, "env": normandy},
+		Transforms: map[string]TransformFunc{
+			"stableSample":        c.stableSample,
+			"bucketSample":        c.bucketSample,
+			"preferenceValue":     c.preferenceValue,
+			"preferenceIsUserSet": c.preferenceIsUserSet,
+			"preferenceExists":    c.preferenceExists,
+			"versionCompare":      versionCompare,
+			"keys":                keys,
+			"length":              length,
+			"mapToProperty":       mapToProperty,
+			"date":                date,
+			"regExpMatch":         regExpMatch,
+		},
+	}
+}
+
+// Matches is true when the revision targets the client.  Revisions without
+// filter objects or an extra filter expression only have the older combined
+// filter_expression.
+func (c *Client) Matches(recipeID int, rev *tools.Revision) (bool, error) {
+	ev := c.Evaluator(recipeID, rev.Arguments.Raw)
+
+	if len(rev.FilterObject) == 0 && strings.TrimSpace(rev.ExtraFilterExpression) == "" {
+		return matchSource(ev, rev.FilterExpression)
+	}
+
+	filters, err := rev.Filters(tools.Strict)
+	if err != nil {
+		return false, err
+	}
+
+	for _, f := range filters {
+		ok, err := c.MatchFilter(ev, f)
+		if err != nil {
+			return false, errors.Wrapf(err, "%s filter", f.FilterType())
+		}
+		if !ok {
+			return false, nil
+		}
+	}
+
+	return matchSource(ev, rev.ExtraFilterExpression)
+}
+
+// MatchFilter is true when filter targets the client.  Sample inputs are
+// evaluated with ev.
+func (c *Client) MatchFilter(ev *Evaluator, filter tools.Filter) (bool, error) {
+	switch f := filter.(type) {
+	case *tools.ChannelFilter:
+		return contains(f.Channels, c.Channel), nil
+
+	case *tools.LocaleFilter:
+		return contains(f.Locales, c.Locale), nil
+
+	case *tools.CountryFilter:
+		return contains(f.Countries, c.Country), nil
+
+	case *tools.VersionFilter:
+		for _, v := range f.Versions {
+			if tools.CompareVersions(c.Version, fmt.Sprintf("%d.!", v)) >= 0 &&
+				tools.CompareVersions(c.Version, fmt.Sprintf("%d.*", v)) < 0 {
+				return true, nil
+			}
+		}
+		return false, nil
+
+	case *tools.VersionRangeFilter:
+		return tools.CompareVersions(c.Version, f.MinVersion) >= 0 &&
+			tools.CompareVersions(c.Version, f.MaxVersion) < 0, nil
+
+	case *tools.PlatformFilter:
+		platform := map[string]string{"Windows_NT": "all_windows", "Darwin": "all_mac", "Linux": "all_linux"}[c.OS]
+		return contains(f.Platforms, platform), nil
+
+	case *tools.BucketSampleFilter:
+		key, err := c.inputKey(ev, f.Input)
+		if err != nil {
+			return false, err
+		}
+		return BucketSample(key, f.Start, f.Count, f.Total)
+
+	case *tools.StableSampleFilter:
+		key, err := c.inputKey(ev, f.Input)
+		if err != nil {
+			return false, err
+		}
+		return StableSample(key, f.Rate)
+
+	case *tools.NamespaceSampleFilter:
+		key, err := c.sampleKey([]interface{}{f.Namespace, c.UserID})
+		if err != nil {
+			return false, err
+		}
+		return BucketSample(key, f.Start, f.Count, tools.NamespaceBuckets)
+
+	case *tools.NegateFilter:
+		inner, err := f.Filter.Decode()
+		if err != nil {
+			return false, err
+		}
+		ok, err := c.MatchFilter(ev, inner)
+		return !ok, err
+
+	case *tools.PresetFilter:
+		n, ok := presetExpression(f.Name)
+		if !ok {
+			return false, errors.Errorf("Unknown preset %q", f.Name)
+		}
+		return ev.Match(n)
+	}
+
+	return false, errors.Errorf("Can't evaluate %s filter", filter.FilterType())
+}
+
+// presetExpression is the expression a preset filter object stands for
+func presetExpression(name string) (Node, bool) {
+	clauses, ok := presets[name]
+	if !ok {
+		return nil, false
+	}
+
+	nodes := make([]Node, len(clauses))
+	for i, src := range clauses {
+		nodes[i] = MustParse(src)
+	}
+	return chain(Pos{Line: 1, Column: 1}, "&&", nodes), true
+}
+
+func matchSource(ev *Evaluator, src string) (bool, error) {
+	if strings.TrimSpace(src) == "" {
+		return true, nil
+	}
+
+	n, err := Parse(src)
+	if err != nil {
+		return false, err
+	}
+	return ev.Match(n)
+}
+
+// inputKey evaluates the JEXL inputs of a sample filter object and hashes them
+func (c *Client) inputKey(ev *Evaluator, input []string) (string, error) {
+	values := make([]interface{}, len(input))
+	for i, src := range input {
+		n, err := Parse(src)
+		if err != nil {
+			return "", err
+		}
+		if values[i], err = ev.Eval(n); err != nil {
+			return "", err
+		}
+	}
+	return c.sampleKey(values)
+}
+
+func (c *Client) sampleKey(input interface{}) (string, error) {
+	if c.SampleBucket != nil {
+		// the middle of the bucket so it's in the same bucket for any total
+		// that's a factor of 10000
+		return FractionToKey((float64(*c.SampleBucket) + 0.5) / tools.NamespaceBuckets)
+	}
+	return SampleKey(input)
+}
+
+func (c *Client) stableSample(subject interface{}, args []interface{}) (interface{}, error) {
+	key, err := c.sampleKey(subject)
+	if err != nil {
+		return nil, err
+	}
+	return StableSample(key, toNumber(arg(args, 0)))
+}
+
+func (c *Client) bucketSample(subject interface{}, args []interface{}) (interface{}, error) {
+	key, err := c.sampleKey(subject)
+	if err != nil {
+		return nil, err
+	}
+	return BucketSample(key, toNumber(arg(args, 0)), toNumber(arg(args, 1)), toNumber(arg(args, 2)))
+}
+
+func (c *Client) preferenceValue(subject interface{}, args []interface{}) (interface{}, error) {
+	if v, ok := c.Preferences[toString(subject)]; ok {
+		return v, nil
+	}
+	return arg(args, 0), nil
+}
+
+func (c *Client) preferenceIsUserSet(subject interface{}, args []interface{}) (interface{}, error) {
+	return contains(c.UserSetPreferences, toString(subject)), nil
+}
+
+func (c *Client) preferenceExists(subject interface{}, args []interface{}) (interface{}, error) {
+	_, ok := c.Preferences[toString(subject)]
+	return ok, nil
+}
+
+func versionCompare(subject interface{}, args []interface{}) (interface{}, error) {
+	return float64(tools.CompareVersions(toString(subject), toString(arg(args, 0)))), nil
+}
+
+func keys(subject interface{}, args []interface{}) (interface{}, error) {
+	if m, ok := subject.(map[string]interface{}); ok {
+		return sortedKeys(m), nil
+	}
+	return nil, nil
+}
+
+func length(subject interface{}, args []interface{}) (interface{}, error) {
+	switch v := subject.(type) {
+	case []interface{}:
+		return float64(len(v)), nil
+	case string:
+		return float64(len([]rune(v))), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, nil
+}
+
+func mapToProperty(subject interface{}, args []interface{}) (interface{}, error) {
+	list, ok := subject.([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	name := toString(arg(args, 0))
+	values := make([]interface{}, len(list))
+	for i, el := range list {
+		values[i] = property(el, name)
+	}
+	return values, nil
+}
+
+// date turns a date string into milliseconds since the epoch so dates
+// compare like javascript Date objects
+func date(subject interface{}, args []interface{}) (interface{}, error) {
+	s := toString(subject)
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return float64(t.UnixNano() / int64(time.Millisecond)), nil
+		}
+	}
+	return nil, errors.Errorf("invalid date %q", s)
+}
+
+func regExpMatch(subject interface{}, args []interface{}) (interface{}, error) {
+	pattern := toString(arg(args, 0))
+	if flags, ok := arg(args, 1).(string); ok && strings.Contains(flags, "i") {
+		pattern = "(?i)" + pattern
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	match := re.FindStringSubmatch(toString(subject))
+	if match == nil {
+		return nil, nil
+	}
+
+	values := make([]interface{}, len(match))
+	for i, m := range match {
+		values[i] = m
+	}
+	return values, nil
+}
+
+func arg(args []interface{}, i int) interface{} {
+	if i < len(args) {
+		return args[i]
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,217 @@
+package jexl
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+func TestVersionCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want float64
+	}{
+		{"78.0", "78.0", 0},
+		{"78", "78.0.0", 0},
+		{"78.0.1", "78.0", 1},
+		{"78.0", "79.0", -1},
+		{"78.10", "78.9", 1},
+		{"100.0", "99.0", 1},
+
+		// pre-releases come before the release
+		{"78.0a1", "78.0", -1},
+		{"78.0b9", "78.0", -1},
+		{"78.0a1", "78.0b1", -1},
+		{"78.0b10", "78.0b9", 1},
+		{"78.0pre", "78.0", -1},
+		{"1.1+", "1.2pre", 0},
+
+		// the bounds version filter objects turn into
+		{"78.!", "78.0a1", -1},
+		{"78.!", "77.9", 1},
+		{"78.*", "78.99.1", 1},
+		{"78.*", "79.0a1", -1},
+	}
+
+	ev := (&Client{}).Evaluator(1, nil)
+	for _, test := range tests {
+		src := fmt.Sprintf("%q|versionCompare(%q)", test.a, test.b)
+		got, err := ev.Eval(MustParse(src))
+		if err != nil || got != test.want {
+			t.Errorf("%s = %v, %v, want %v", src, got, err, test.want)
+		}
+
+		// and the other way around
+		src = fmt.Sprintf("%q|versionCompare(%q)", test.b, test.a)
+		if got, err := ev.Eval(MustParse(src)); err != nil || got != -test.want {
+			t.Errorf("%s = %v, %v, want %v", src, got, err, -test.want)
+		}
+	}
+}
+
+func revision(t *testing.T, filterExpression, extra string, filterObjects ...string) *tools.Revision {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]interface{}{
+		"filter_expression":       filterExpression,
+		"extra_filter_expression": extra,
+		"filter_object":           json.RawMessage("[" + strings.Join(filterObjects, ",") + "]"),
+		"arguments":               map[string]string{"slug": "test-recipe"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rev tools.Revision
+	if err := json.Unmarshal(data, &rev); err != nil {
+		t.Fatal(err)
+	}
+	return &rev
+}
+
+func TestClientMatches(t *testing.T) {
+	bucket := 412
+	bucketed := &Client{
+		UserID:             "user-1",
+		Version:            "78.0.2",
+		Channel:            "release",
+		Locale:             "de-DE",
+		Country:            "DE",
+		OS:                 "Linux",
+		Preferences:        map[string]interface{}{"p.enabled": true},
+		UserSetPreferences: []string{"p.enabled"},
+		Extra:              map[string]interface{}{"isDefaultBrowser": true},
+		SampleBucket:       &bucket,
+	}
+
+	// the same client without a bucket, its samples hash normandy.userId
+	hashed := *bucketed
+	hashed.SampleBucket = nil
+
+	tests := []struct {
+		name          string
+		client        *Client
+		filters       []string
+		extra, filter string
+		want          bool
+	}{
+		{name: "channel", filters: []string{`{"type":"channel","channels":["beta","release"]}`}, want: true},
+		{name: "other channel", filters: []string{`{"type":"channel","channels":["beta"]}`}},
+		{name: "locale", filters: []string{`{"type":"locale","locales":["de-DE"]}`}, want: true},
+		{name: "other locale", filters: []string{`{"type":"locale","locales":["de"]}`}},
+		{name: "country", filters: []string{`{"type":"country","countries":["DE","AT"]}`}, want: true},
+		{name: "other country", filters: []string{`{"type":"country","countries":["US"]}`}},
+		{name: "version", filters: []string{`{"type":"version","versions":[77,78]}`}, want: true},
+		{name: "other version", filters: []string{`{"type":"version","versions":[79]}`}},
+		{name: "version range", filters: []string{`{"type":"versionRange","min_version":"78.0","max_version":"78.0.3"}`}, want: true},
+		{name: "version range end", filters: []string{`{"type":"versionRange","min_version":"77.0","max_version":"78.0.2"}`}},
+		{name: "platform", filters: []string{`{"type":"platform","platforms":["all_linux"]}`}, want: true},
+		{name: "other platform", filters: []string{`{"type":"platform","platforms":["all_mac","all_windows"]}`}},
+
+		// bucket 412 of 10000 is 0.0412 to 0.0413
+		{name: "bucket sample", filters: []string{`{"type":"bucketSample","input":["normandy.userId"],"start":400,"count":100,"total":10000}`}, want: true},
+		{name: "other bucket sample", filters: []string{`{"type":"bucketSample","input":["normandy.userId"],"start":413,"count":100,"total":10000}`}},
+		{name: "bucket sample wraps", filters: []string{`{"type":"bucketSample","input":["normandy.userId"],"start":9950,"count":500,"total":10000}`}, want: true},
+		{name: "bucket sample smaller total", filters: []string{`{"type":"bucketSample","input":["normandy.userId"],"start":41,"count":1,"total":1000}`}, want: true},
+		{name: "stable sample", filters: []string{`{"type":"stableSample","input":["normandy.userId"],"rate":0.0413}`}, want: true},
+		{name: "other stable sample", filters: []string{`{"type":"stableSample","input":["normandy.userId"],"rate":0.0412}`}},
+		{name: "namespace sample", filters: []string{`{"type":"namespaceSample","namespace":"ns","start":412,"count":1}`}, want: true},
+		{name: "other namespace sample", filters: []string{`{"type":"namespaceSample","namespace":"ns","start":9990,"count":20}`}},
+
+		// ["user-1"] hashes to b5729fb0e3ca, 0.7088, and ["ns","user-1"] to
+		// f1dea6e0f2f7, bucket 9448
+		{name: "hashed stable sample", client: &hashed, filters: []string{`{"type":"stableSample","input":["normandy.userId"],"rate":0.71}`}, want: true},
+		{name: "hashed other stable sample", client: &hashed, filters: []string{`{"type":"stableSample","input":["normandy.userId"],"rate":0.7}`}},
+		{name: "hashed namespace sample", client: &hashed, filters: []string{`{"type":"namespaceSample","namespace":"ns","start":9448,"count":1}`}, want: true},
+		{name: "hashed other namespace sample", client: &hashed, filters: []string{`{"type":"namespaceSample","namespace":"ns","start":9449,"count":100}`}},
+		{name: "hashed bucket sample", client: &hashed, filters: []string{`{"type":"bucketSample","input":["\"ns\"","normandy.userId"],"start":9448,"count":1,"total":10000}`}, want: true},
+
+		{name: "negate", filters: []string{`{"type":"negate","filter":{"type":"channel","channels":["beta"]}}`}, want: true},
+		{name: "negate match", filters: []string{`{"type":"negate","filter":{"type":"channel","channels":["release"]}}`}},
+		{name: "preset", client: &Client{Preferences: map[string]interface{}{
+			"browser.newtabpage.activity-stream.feeds.section.topstories": true,
+			"browser.newtabpage.activity-stream.feeds.system.topstories":  true,
+		}}, filters: []string{`{"type":"presets","name":"pocket-1"}`}, want: true},
+		{name: "preset user set", client: &Client{Preferences: map[string]interface{}{
+			"browser.newtabpage.activity-stream.feeds.section.topstories": true,
+			"browser.newtabpage.activity-stream.feeds.system.topstories":  true,
+		}, UserSetPreferences: []string{"browser.startup.homepage"}}, filters: []string{`{"type":"preset","name":"pocket-1"}`}},
+
+		// every filter object and the extra expression have to match
+		{
+			name:    "all filter objects",
+			filters: []string{`{"type":"channel","channels":["release"]}`, `{"type":"locale","locales":["de-DE"]}`},
+			want:    true,
+		},
+		{
+			name:    "one filter object fails",
+			filters: []string{`{"type":"channel","channels":["release"]}`, `{"type":"locale","locales":["en-US"]}`},
+		},
+		{
+			name:    "extra expression",
+			filters: []string{`{"type":"channel","channels":["release"]}`},
+			extra:   `normandy.isDefaultBrowser && "p.enabled"|preferenceIsUserSet`,
+			want:    true,
+		},
+		{
+			name:    "extra expression fails",
+			filters: []string{`{"type":"channel","channels":["release"]}`},
+			extra:   `!normandy.isDefaultBrowser`,
+		},
+		{name: "only extra expression", extra: `normandy.recipe.arguments.slug == "test-recipe"`, want: true},
+
+		// the combined filter_expression is only used without the others
+		{name: "filter expression", filter: `normandy.channel == "release"`, want: true},
+		{name: "filter expression fails", filter: `normandy.channel == "beta"`},
+		{
+			name:    "filter expression ignored",
+			filter:  `normandy.channel == "beta"`,
+			filters: []string{`{"type":"channel","channels":["release"]}`},
+			want:    true,
+		},
+		{name: "no targeting", want: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := test.client
+			if c == nil {
+				c = bucketed
+			}
+
+			got, err := c.Matches(1, revision(t, test.filter, test.extra, test.filters...))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("Matches = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestClientMatchesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		extra   string
+	}{
+		{name: "unknown filter type", filters: []string{`{"type":"weather","sunny":true}`}},
+		{name: "unknown preset", filters: []string{`{"type":"presets","name":"pocket-99"}`}},
+		{name: "unknown field", filters: []string{`{"type":"channel","channels":["release"],"locales":["de"]}`}},
+		{name: "bad sample input", filters: []string{`{"type":"stableSample","input":["normandy.userId &&"],"rate":0.5}`}},
+		{name: "bad extra expression", extra: `normandy.channel ==`},
+	}
+
+	client := &Client{Channel: "release"}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := client.Matches(1, revision(t, "", test.extra, test.filters...)); err == nil {
+				t.Error("Matches didn't fail")
+			}
+		})
+	}
+}
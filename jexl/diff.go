@@ -0,0 +1,88 @@
+package jexl
+
+import "sort"
+
+type ChangeKind string
+
+const (
+	Added    ChangeKind = "added"
+	Removed  ChangeKind = "removed"
+	Modified ChangeKind = "modified"
+)
+
+// ClauseChange is a difference in one clause between two expressions.  Old
+// is empty for Added clauses and New is empty for Removed ones.
+type ClauseChange struct {
+	Kind ChangeKind
+	Old  string
+	New  string
+}
+
+// Diff compares the canonical clauses of two expressions.  A nil node is an
+// empty expression.  Removed and added clauses that use the same context
+// references and transforms are paired up as Modified.
+func Diff(old, new Node) []ClauseChange {
+	oldClauses := canonicalClauses(old)
+	newClauses := canonicalClauses(new)
+
+	var removed, added []Node
+	for k, n := range oldClauses {
+		if _, ok := newClauses[k]; !ok {
+			removed = append(removed, n)
+		}
+	}
+	for k, n := range newClauses {
+		if _, ok := oldClauses[k]; !ok {
+			added = append(added, n)
+		}
+	}
+
+	sortNodes(removed)
+	sortNodes(added)
+
+	var changes []ClauseChange
+	paired := make(map[int]bool)
+	for _, r := range removed {
+		sig := signature(r)
+		match := -1
+		for i, a := range added {
+			if !paired[i] && signature(a) == sig {
+				match = i
+				break
+			}
+		}
+
+		if match == -1 {
+			changes = append(changes, ClauseChange{Kind: Removed, Old: r.String()})
+			continue
+		}
+
+		paired[match] = true
+		changes = append(changes, ClauseChange{Kind: Modified, Old: r.String(), New: added[match].String()})
+	}
+
+	for i, a := range added {
+		if !paired[i] {
+			changes = append(changes, ClauseChange{Kind: Added, New: a.String()})
+		}
+	}
+
+	return changes
+}
+
+// canonicalClauses returns n's canonical clauses keyed by their source
+func canonicalClauses(n Node) map[string]Node {
+	clauses := make(map[string]Node)
+	if n == nil {
+		return clauses
+	}
+
+	for _, c := range Clauses(Canonical(n)) {
+		clauses[c.String()] = c
+	}
+	return clauses
+}
+
+func sortNodes(nodes []Node) {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].String() < nodes[j].String() })
+}
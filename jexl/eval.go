@@ -0,0 +1,422 @@
+package jexl
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TransformFunc implements a transform, it's called with the evaluated
+// subject and arguments
+type TransformFunc func(subject interface{}, args []interface{}) (interface{}, error)
+
+// Evaluator evaluates expressions the way mozjexl does.  Values are nil
+// (null and undefined), bool, float64, string, []interface{} and
+// map[string]interface{}.
+type Evaluator struct {
+	Context    map[string]interface{}
+	Transforms map[string]TransformFunc
+}
+
+// Eval evaluates n.  Errors are *Error with the position of the problem.
+func (e *Evaluator) Eval(n Node) (interface{}, error) {
+	return e.eval(n, nil)
+}
+
+// Match evaluates n and returns if the result is truthy
+func (e *Evaluator) Match(n Node) (bool, error) {
+	v, err := e.Eval(n)
+	return Truthy(v), err
+}
+
+// eval evaluates n, relative is the element a filter is looking at
+func (e *Evaluator) eval(n Node, relative interface{}) (interface{}, error) {
+	switch n := n.(type) {
+	case *Literal:
+		return n.Value, nil
+
+	case *Identifier:
+		if n.Relative {
+			return property(relative, n.Name), nil
+		}
+		if n.From == nil {
+			return e.Context[n.Name], nil
+		}
+
+		from, err := e.eval(n.From, relative)
+		if err != nil {
+			return nil, err
+		}
+		return property(from, n.Name), nil
+
+	case *Unary:
+		v, err := e.eval(n.Operand, relative)
+		if err != nil {
+			return nil, err
+		}
+		if n.Op == "!" {
+			return !Truthy(v), nil
+		}
+		return -toNumber(v), nil
+
+	case *Binary:
+		return e.evalBinary(n, relative)
+
+	case *Conditional:
+		test, err := e.eval(n.Test, relative)
+		if err != nil {
+			return nil, err
+		}
+		if Truthy(test) {
+			return e.eval(n.Consequent, relative)
+		}
+		return e.eval(n.Alternate, relative)
+
+	case *Transform:
+		fn, ok := e.Transforms[n.Name]
+		if !ok {
+			return nil, &Error{n.At, fmt.Sprintf("unknown transform %q", n.Name)}
+		}
+
+		subject, err := e.eval(n.Subject, relative)
+		if err != nil {
+			return nil, err
+		}
+
+		args := make([]interface{}, len(n.Args))
+		for i, a := range n.Args {
+			if args[i], err = e.eval(a, relative); err != nil {
+				return nil, err
+			}
+		}
+
+		v, err := fn(subject, args)
+		if err != nil {
+			return nil, &Error{n.At, n.Name + ": " + err.Error()}
+		}
+		return v, nil
+
+	case *Filter:
+		return e.evalFilter(n, relative)
+
+	case *Array:
+		values := make([]interface{}, len(n.Elements))
+		for i, el := range n.Elements {
+			v, err := e.eval(el, relative)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = v
+		}
+		return values, nil
+
+	case *Object:
+		values := make(map[string]interface{}, len(n.Entries))
+		for _, entry := range n.Entries {
+			v, err := e.eval(entry.Value, relative)
+			if err != nil {
+				return nil, err
+			}
+			values[entry.Key] = v
+		}
+		return values, nil
+	}
+
+	return nil, &Error{n.Pos(), fmt.Sprintf("can't evaluate %T", n)}
+}
+
+func (e *Evaluator) evalBinary(n *Binary, relative interface{}) (interface{}, error) {
+	left, err := e.eval(n.Left, relative)
+	if err != nil {
+		return nil, err
+	}
+
+	// like javascript these return one of the operands
+	switch n.Op {
+	case "&&":
+		if !Truthy(left) {
+			return left, nil
+		}
+		return e.eval(n.Right, relative)
+	case "||":
+		if Truthy(left) {
+			return left, nil
+		}
+		return e.eval(n.Right, relative)
+	}
+
+	right, err := e.eval(n.Right, relative)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case "==":
+		return looseEqual(left, right), nil
+	case "!=":
+		return !looseEqual(left, right), nil
+	case "<", "<=", ">", ">=":
+		return compare(n.Op, left, right), nil
+	case "in":
+		switch r := right.(type) {
+		case []interface{}:
+			for _, v := range r {
+				if strictEqual(left, v) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case string:
+			return strings.Contains(r, toString(left)), nil
+		}
+		return false, nil
+	case "+":
+		_, ls := left.(string)
+		_, rs := right.(string)
+		if ls || rs {
+			return toString(left) + toString(right), nil
+		}
+		return toNumber(left) + toNumber(right), nil
+	}
+
+	l, r := toNumber(left), toNumber(right)
+	switch n.Op {
+	case "-":
+		return l - r, nil
+	case "*":
+		return l * r, nil
+	case "/":
+		return l / r, nil
+	case "//":
+		return math.Floor(l / r), nil
+	case "%":
+		return math.Mod(l, r), nil
+	case "^":
+		return math.Pow(l, r), nil
+	}
+
+	return nil, &Error{n.At, fmt.Sprintf("unknown operator %q", n.Op)}
+}
+
+// evalFilter either filters the elements of an array, list[.foo == 1], or
+// looks up an index or key, list[0] or obj["key"]
+func (e *Evaluator) evalFilter(n *Filter, relative interface{}) (interface{}, error) {
+	subject, err := e.eval(n.Subject, relative)
+	if err != nil {
+		return nil, err
+	}
+
+	if !isRelative(n.Expr) {
+		index, err := e.eval(n.Expr, relative)
+		if err != nil {
+			return nil, err
+		}
+
+		if list, ok := subject.([]interface{}); ok {
+			if i, ok := index.(float64); ok {
+				if i >= 0 && int(i) < len(list) && i == math.Trunc(i) {
+					return list[int(i)], nil
+				}
+				return nil, nil
+			}
+		}
+		return property(subject, toString(index)), nil
+	}
+
+	list, ok := subject.([]interface{})
+	if !ok {
+		if subject == nil {
+			return []interface{}{}, nil
+		}
+		list = []interface{}{subject}
+	}
+
+	matches := []interface{}{}
+	for _, el := range list {
+		v, err := e.eval(n.Expr, el)
+		if err != nil {
+			return nil, err
+		}
+		if Truthy(v) {
+			matches = append(matches, el)
+		}
+	}
+	return matches, nil
+}
+
+// isRelative is true when n uses .foo identifiers outside of nested filters
+func isRelative(n Node) bool {
+	found := false
+	Walk(n, func(n Node) bool {
+		switch n := n.(type) {
+		case *Identifier:
+			if n.Relative {
+				found = true
+			}
+		case *Filter:
+			// only the subject belongs to this filter
+			if isRelative(n.Subject) {
+				found = true
+			}
+			return false
+		}
+		return !found
+	})
+	return found
+}
+
+// property looks up name on v.  Like mozjexl, looking something up on an
+// array uses its first element and anything missing is undefined.
+func property(v interface{}, name string) interface{} {
+	if list, ok := v.([]interface{}); ok {
+		if len(list) == 0 {
+			return nil
+		}
+		v = list[0]
+	}
+
+	if m, ok := v.(map[string]interface{}); ok {
+		return m[name]
+	}
+	return nil
+}
+
+// Truthy follows javascript: false, 0, NaN, "", null and undefined are false
+func Truthy(v interface{}) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0 && !math.IsNaN(v)
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+func toNumber(v interface{}) float64 {
+	switch v := v.(type) {
+	case float64:
+		return v
+	case bool:
+		if v {
+			return 1
+		}
+		return 0
+	case string:
+		s := strings.TrimSpace(v)
+		if s == "" {
+			return 0
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return math.NaN()
+}
+
+func toString(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, el := range v {
+			if el != nil {
+				parts[i] = toString(el)
+			}
+		}
+		return strings.Join(parts, ",")
+	}
+	return "[object Object]"
+}
+
+// strictEqual is javascript's ===, arrays and objects are never equal
+func strictEqual(a, b interface{}) bool {
+	switch a := a.(type) {
+	case nil:
+		return b == nil
+	case bool, float64, string:
+		return a == b
+	}
+	return false
+}
+
+// looseEqual is javascript's ==
+func looseEqual(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	switch a.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+	switch b.(type) {
+	case []interface{}, map[string]interface{}:
+		return false
+	}
+
+	as, aok := a.(string)
+	bs, bok := b.(string)
+	if aok && bok {
+		return as == bs
+	}
+	return toNumber(a) == toNumber(b)
+}
+
+func compare(op string, a, b interface{}) bool {
+	as, aok := a.(string)
+	bs, bok := b.(string)
+
+	var c int
+	if aok && bok {
+		c = strings.Compare(as, bs)
+	} else {
+		l, r := toNumber(a), toNumber(b)
+		if math.IsNaN(l) || math.IsNaN(r) {
+			return false
+		}
+		switch {
+		case l < r:
+			c = -1
+		case l > r:
+			c = 1
+		}
+	}
+
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+// sortedKeys returns the keys of an object value
+func sortedKeys(m map[string]interface{}) []interface{} {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	values := make([]interface{}, len(keys))
+	for i, k := range keys {
+		values[i] = k
+	}
+	return values
+}
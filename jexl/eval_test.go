@@ -0,0 +1,170 @@
+package jexl
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// evalContext is the context the eval tests run against
+const evalContext = `{
+	"list": [{"a": 1, "b": "x"}, {"a": 2, "b": "y"}, {"a": 1, "b": "z"}],
+	"obj": {"k": {"x": true}, "n": 0},
+	"str": "hello",
+	"one": 1,
+	"zero": 0,
+	"empty": "",
+	"null": null
+}`
+
+func evalTests(t *testing.T, tests []struct {
+	src  string
+	want interface{}
+}) {
+	t.Helper()
+
+	var context map[string]interface{}
+	if err := json.Unmarshal([]byte(evalContext), &context); err != nil {
+		t.Fatal(err)
+	}
+	ev := &Evaluator{Context: context}
+
+	for _, test := range tests {
+		got, err := ev.Eval(MustParse(test.src))
+		if err != nil {
+			t.Errorf("Eval(%s) error: %v", test.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Eval(%s) = %#v, want %#v", test.src, got, test.want)
+		}
+	}
+}
+
+func TestEvalEquality(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		// == is javascript's loose equality
+		{`1 == "1"`, true},
+		{`"1.0" == 1`, true},
+		{`" 1 " == 1`, true},
+		{`0 == ""`, true},
+		{`zero == empty`, true},
+		{`true == 1`, true},
+		{`false == "0"`, true},
+		{`"a" == "a"`, true},
+		{`"1.0" == "1"`, false},
+		{`"a" == 0`, false},
+		{`null == missing`, true},
+		{`null == 0`, false},
+		{`missing == ""`, false},
+		{`missing == false`, false},
+		{`[1] == [1]`, false},
+		{`[1] == 1`, false},
+		{`obj == obj`, false},
+		{`{} == {}`, false},
+		{`1 != "1"`, false},
+		{`null != 0`, true},
+	})
+}
+
+func TestEvalIn(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		// arrays use ===
+		{`"a" in ["a", "b"]`, true},
+		{`"c" in ["a", "b"]`, false},
+		{`1 in [1, 2]`, true},
+		{`1 in ["1"]`, false},
+		{`true in [1]`, false},
+		{`null in [null]`, true},
+		{`[1] in [[1]]`, false},
+		{`"a" in []`, false},
+
+		// strings are searched for a substring
+		{`"ell" in str`, true},
+		{`"" in str`, true},
+		{`"xyz" in str`, false},
+		{`1 in "a1"`, true},
+
+		// anything else has nothing in it
+		{`"k" in obj`, false},
+		{`"a" in missing`, false},
+		{`1 in 1`, false},
+	})
+}
+
+func TestEvalFilter(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		// relative expressions filter
+		{`list[.a == 1]`, []interface{}{
+			map[string]interface{}{"a": 1.0, "b": "x"},
+			map[string]interface{}{"a": 1.0, "b": "z"},
+		}},
+		{`list[.a == 3]`, []interface{}{}},
+		{`list[.a == 2].b`, "y"},
+		{`list[.a == 1].b`, "x"},
+		{`list[.a == 3].b`, nil},
+		{`list[.a > 1 && .b != "x"].b`, "y"},
+
+		// anything that isn't an array is a list of itself, undefined is empty
+		{`obj.k[.x]`, []interface{}{map[string]interface{}{"x": true}}},
+		{`obj.k[!.x]`, []interface{}{}},
+		{`missing[.x]`, []interface{}{}},
+
+		// everything else is an index or key
+		{`list[1].b`, "y"},
+		{`list[3]`, nil},
+		{`list[-1]`, nil},
+		{`list[1.5]`, nil},
+		{`obj["n"]`, 0.0},
+		{`obj["missing"]`, nil},
+		{`obj[zero == 0 ? "n" : "k"]`, 0.0},
+
+		// looking something up on an array uses its first element
+		{`list.b`, "x"},
+		{`[].b`, nil},
+	})
+}
+
+func TestEvalOperators(t *testing.T) {
+	evalTests(t, []struct {
+		src  string
+		want interface{}
+	}{
+		// && and || return one of their operands
+		{`0 || "a"`, "a"},
+		{`one || "a"`, 1.0},
+		{`empty && 1`, ""},
+		{`one && "a"`, "a"},
+		{`missing && 1`, nil},
+		{`!empty`, true},
+		{`!str`, false},
+		{`!(list[.a == 3])`, false},
+
+		// + joins strings, anything else is arithmetic
+		{`"a" + 1`, "a1"},
+		{`1 + 2`, 3.0},
+		{`true + 1`, 2.0},
+		{`"a" + null`, "anull"},
+		{`"a" + [1, 2]`, "a1,2"},
+		{`7 // 2`, 3.0},
+		{`7 % 4`, 3.0},
+		{`2 ^ 10`, 1024.0},
+
+		// strings compare as strings, anything else as numbers
+		{`"10" < "9"`, true},
+		{`"10" < 9`, false},
+		{`"b" >= "a"`, true},
+		{`"a" < 1`, false},
+		{`"a" >= 1`, false},
+		{`true > 0`, true},
+	})
+}
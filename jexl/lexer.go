@@ -0,0 +1,233 @@
+package jexl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in the expression source
+type Pos struct {
+	Offset int // byte offset, starting at 0
+	Line   int // starting at 1
+	Column int // in bytes, starting at 1
+}
+
+func (p Pos) String() string {
+	return fmt.Sprintf("line %d col %d", p.Line, p.Column)
+}
+
+// Error is a tokenizing or parsing error at a position in the source
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("jexl: %s: %s", e.Pos, e.Msg)
+}
+
+type tokenType int
+
+const (
+	tokEOF tokenType = iota
+	tokNumber
+	tokString
+	tokBool
+	tokNull
+	tokIdentifier
+	tokOperator // binary and unary operators, including "in"
+	tokDot
+	tokPipe
+	tokQuestion
+	tokColon
+	tokComma
+	tokOpenParen
+	tokCloseParen
+	tokOpenBracket
+	tokCloseBracket
+	tokOpenCurly
+	tokCloseCurly
+)
+
+type token struct {
+	typ   tokenType
+	value string // the decoded value for strings, raw text for the rest
+	raw   string
+	pos   Pos
+}
+
+// punctuation is matched longest first
+var punctuation = []struct {
+	text string
+	typ  tokenType
+}{
+	{"==", tokOperator}, {"!=", tokOperator}, {">=", tokOperator}, {"<=", tokOperator},
+	{"&&", tokOperator}, {"||", tokOperator}, {"//", tokOperator},
+	{"+", tokOperator}, {"-", tokOperator}, {"*", tokOperator}, {"/", tokOperator},
+	{"%", tokOperator}, {"^", tokOperator}, {">", tokOperator}, {"<", tokOperator},
+	{"!", tokOperator},
+	{".", tokDot}, {"|", tokPipe}, {"?", tokQuestion}, {":", tokColon}, {",", tokComma},
+	{"(", tokOpenParen}, {")", tokCloseParen},
+	{"[", tokOpenBracket}, {"]", tokCloseBracket},
+	{"{", tokOpenCurly}, {"}", tokCloseCurly},
+}
+
+type lexer struct {
+	src  string
+	off  int
+	line int
+	col  int
+}
+
+func (l *lexer) pos() Pos {
+	return Pos{Offset: l.off, Line: l.line, Column: l.col}
+}
+
+func (l *lexer) advance(n int) {
+	for _, c := range l.src[l.off : l.off+n] {
+		if c == '\n' {
+			l.line++
+			l.col = 1
+		} else {
+			l.col += len(string(c))
+		}
+	}
+	l.off += n
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+func isIdentStart(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+func isIdentPart(c byte) bool { return isIdentStart(c) || isDigit(c) }
+
+// tokenize splits src into tokens, ending with a tokEOF
+func tokenize(src string) ([]token, error) {
+	l := &lexer{src: src, line: 1, col: 1}
+	var tokens []token
+
+	for {
+		// whitespace, including new lines, separates tokens
+		for l.off < len(src) && strings.IndexByte(" \t\r\n", src[l.off]) >= 0 {
+			l.advance(1)
+		}
+
+		start := l.pos()
+		if l.off >= len(src) {
+			tokens = append(tokens, token{typ: tokEOF, pos: start})
+			return tokens, nil
+		}
+
+		c := src[l.off]
+		rest := src[l.off:]
+
+		switch {
+		case c == '"' || c == '\'':
+			value, n, err := scanString(rest)
+			if err != nil {
+				return nil, &Error{start, err.Error()}
+			}
+			tokens = append(tokens, token{tokString, value, rest[:n], start})
+			l.advance(n)
+
+		case isDigit(c) || c == '.' && len(rest) > 1 && isDigit(rest[1]) && !afterOperand(tokens):
+			n := 0
+			for n < len(rest) && isDigit(rest[n]) {
+				n++
+			}
+			if n < len(rest)-1 && rest[n] == '.' && isDigit(rest[n+1]) {
+				n++
+				for n < len(rest) && isDigit(rest[n]) {
+					n++
+				}
+			}
+			tokens = append(tokens, token{tokNumber, rest[:n], rest[:n], start})
+			l.advance(n)
+
+		case isIdentStart(c):
+			n := 1
+			for n < len(rest) && isIdentPart(rest[n]) {
+				n++
+			}
+
+			word := rest[:n]
+			typ := tokIdentifier
+			switch word {
+			case "true", "false":
+				typ = tokBool
+			case "null":
+				typ = tokNull
+			case "in":
+				typ = tokOperator
+			}
+
+			// after a dot everything is a property name, ie: foo.in
+			if len(tokens) > 0 && tokens[len(tokens)-1].typ == tokDot {
+				typ = tokIdentifier
+			}
+
+			tokens = append(tokens, token{typ, word, word, start})
+			l.advance(n)
+
+		default:
+			matched := false
+			for _, p := range punctuation {
+				if strings.HasPrefix(rest, p.text) {
+					tokens = append(tokens, token{p.typ, p.text, p.text, start})
+					l.advance(len(p.text))
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				return nil, &Error{start, fmt.Sprintf("unexpected character %q", c)}
+			}
+		}
+	}
+}
+
+// afterOperand is true when the last token ends an operand, so a "." is
+// property access and not the start of a number like .5
+func afterOperand(tokens []token) bool {
+	if len(tokens) == 0 {
+		return false
+	}
+
+	switch tokens[len(tokens)-1].typ {
+	case tokIdentifier, tokNumber, tokString, tokBool, tokNull, tokCloseParen, tokCloseBracket, tokCloseCurly:
+		return true
+	}
+	return false
+}
+
+// scanString reads a quoted string at the start of s and returns its value
+// and how many bytes it used
+func scanString(s string) (string, int, error) {
+	quote := s[0]
+	var b strings.Builder
+
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				// \" \' \\ and anything else is the character itself
+				b.WriteByte(s[i])
+			}
+		case c == quote:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(c)
+		}
+	}
+
+	return "", 0, fmt.Errorf("unterminated string")
+}
@@ -0,0 +1,348 @@
+// Package jexl parses the Mozilla JEXL dialect used in Normandy's
+// filter_expression and extra_filter_expression into an AST.
+//
+// It follows mozjexl's grammar: binary operators with mozjexl's precedence
+// (&& and || are equal), unary !, the ternary operator, "in", transforms
+// (value|name(args)), filters (value[expr]) and array and object literals.
+package jexl
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Parse parses a JEXL expression.  Errors are *Error with the position of
+// the problem.
+func Parse(src string) (Node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().typ == tokEOF {
+		return nil, &Error{p.peek().pos, "empty expression"}
+	}
+
+	n, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.typ != tokEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return n, nil
+}
+
+// MustParse is Parse that panics on errors, for expressions known to be good
+func MustParse(src string) Node {
+	n, err := Parse(src)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// Normalize parses src and returns it in the normalized form of Node.String
+func Normalize(src string) (string, error) {
+	n, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return n.String(), nil
+}
+
+type parser struct {
+	tokens []token
+	i      int
+
+	// filterDepth is > 0 inside a filter where relative identifiers
+	// are allowed
+	filterDepth int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.typ != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.typ == tokEOF {
+		return &Error{t.pos, "unexpected end of expression"}
+	}
+	return &Error{t.pos, fmt.Sprintf("unexpected %q", t.raw)}
+}
+
+func (p *parser) expect(typ tokenType, what string) (token, error) {
+	t := p.next()
+	if t.typ != typ {
+		if t.typ == tokEOF {
+			return t, &Error{t.pos, "expected " + what + ", got end of expression"}
+		}
+		return t, &Error{t.pos, fmt.Sprintf("expected %s, got %q", what, t.raw)}
+	}
+	return t, nil
+}
+
+// parseExpression parses the lowest precedence level, the ternary operator
+func (p *parser) parseExpression() (Node, error) {
+	test, err := p.parseBinary(precConditional + 1)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.peek().typ != tokQuestion {
+		return test, nil
+	}
+	q := p.next()
+
+	consequent, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := p.expect(tokColon, `":"`); err != nil {
+		return nil, err
+	}
+
+	alternate, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Conditional{At: q.pos, Test: test, Consequent: consequent, Alternate: alternate}, nil
+}
+
+// parseBinary parses binary operators with at least min precedence
+func (p *parser) parseBinary(min int) (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		t := p.peek()
+		prec, ok := binaryPrecedence[t.value]
+		if t.typ != tokOperator || !ok || prec < min {
+			return left, nil
+		}
+		p.next()
+
+		// left associative: the right side only takes tighter operators
+		right, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		left = &Binary{At: t.pos, Op: t.value, Left: left, Right: right}
+	}
+}
+
+func (p *parser) parseUnary() (Node, error) {
+	t := p.peek()
+	if t.typ == tokOperator && (t.value == "!" || t.value == "-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		// -5 is just a negative number
+		if lit, ok := operand.(*Literal); ok && t.value == "-" {
+			if f, ok := lit.Value.(float64); ok {
+				return &Literal{At: t.pos, Value: -f}, nil
+			}
+		}
+
+		return &Unary{At: t.pos, Op: t.value, Operand: operand}, nil
+	}
+
+	operand, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	return p.parsePostfix(operand)
+}
+
+func (p *parser) parsePrimary() (Node, error) {
+	t := p.next()
+
+	switch t.typ {
+	case tokNumber:
+		f, err := strconv.ParseFloat(t.value, 64)
+		if err != nil {
+			return nil, &Error{t.pos, "invalid number " + t.raw}
+		}
+		return &Literal{At: t.pos, Value: f}, nil
+
+	case tokString:
+		return &Literal{At: t.pos, Value: t.value}, nil
+
+	case tokBool:
+		return &Literal{At: t.pos, Value: t.value == "true"}, nil
+
+	case tokNull:
+		return &Literal{At: t.pos, Value: nil}, nil
+
+	case tokIdentifier:
+		return &Identifier{At: t.pos, Name: t.value}, nil
+
+	case tokDot:
+		// .foo is only valid inside a filter: list[.foo == 1]
+		if p.filterDepth == 0 {
+			return nil, p.unexpected(t)
+		}
+		name, err := p.expect(tokIdentifier, "identifier")
+		if err != nil {
+			return nil, err
+		}
+		return &Identifier{At: t.pos, Name: name.value, Relative: true}, nil
+
+	case tokOpenParen:
+		n, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect(tokCloseParen, `")"`); err != nil {
+			return nil, err
+		}
+		return n, nil
+
+	case tokOpenBracket:
+		elements, err := p.parseList(tokCloseBracket, `"]"`)
+		if err != nil {
+			return nil, err
+		}
+		return &Array{At: t.pos, Elements: elements}, nil
+
+	case tokOpenCurly:
+		return p.parseObject(t)
+	}
+
+	return nil, p.unexpected(t)
+}
+
+// parseList parses comma separated expressions up to the closing token
+func (p *parser) parseList(end tokenType, what string) ([]Node, error) {
+	var nodes []Node
+	if p.peek().typ == end {
+		p.next()
+		return nodes, nil
+	}
+
+	for {
+		n, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, n)
+
+		t := p.next()
+		switch t.typ {
+		case tokComma:
+			continue
+		case end:
+			return nodes, nil
+		}
+		if t.typ == tokEOF {
+			return nil, &Error{t.pos, `expected "," or ` + what + ", got end of expression"}
+		}
+		return nil, &Error{t.pos, fmt.Sprintf(`expected "," or %s, got %q`, what, t.raw)}
+	}
+}
+
+func (p *parser) parseObject(open token) (Node, error) {
+	obj := &Object{At: open.pos}
+	if p.peek().typ == tokCloseCurly {
+		p.next()
+		return obj, nil
+	}
+
+	for {
+		key := p.next()
+		if key.typ != tokIdentifier && key.typ != tokString {
+			return nil, &Error{key.pos, fmt.Sprintf("expected object key, got %q", key.raw)}
+		}
+
+		if _, err := p.expect(tokColon, `":"`); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		obj.Entries = append(obj.Entries, ObjectEntry{key.value, value})
+
+		t := p.next()
+		switch t.typ {
+		case tokComma:
+			continue
+		case tokCloseCurly:
+			return obj, nil
+		}
+		if t.typ == tokEOF {
+			return nil, &Error{t.pos, `expected "," or "}", got end of expression`}
+		}
+		return nil, &Error{t.pos, fmt.Sprintf(`expected "," or "}", got %q`, t.raw)}
+	}
+}
+
+// parsePostfix parses property access, filters and transforms that follow
+// an operand
+func (p *parser) parsePostfix(n Node) (Node, error) {
+	for {
+		t := p.peek()
+		switch t.typ {
+		case tokDot:
+			p.next()
+			name, err := p.expect(tokIdentifier, "identifier")
+			if err != nil {
+				return nil, err
+			}
+			n = &Identifier{At: name.pos, Name: name.value, From: n}
+
+		case tokOpenBracket:
+			p.next()
+			p.filterDepth++
+			expr, err := p.parseExpression()
+			p.filterDepth--
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokCloseBracket, `"]"`); err != nil {
+				return nil, err
+			}
+			n = &Filter{At: t.pos, Subject: n, Expr: expr}
+
+		case tokPipe:
+			p.next()
+			name, err := p.expect(tokIdentifier, "transform name")
+			if err != nil {
+				return nil, err
+			}
+
+			transform := &Transform{At: t.pos, Name: name.value, Subject: n}
+			if p.peek().typ == tokOpenParen {
+				p.next()
+				transform.Args, err = p.parseList(tokCloseParen, `")"`)
+				if err != nil {
+					return nil, err
+				}
+			}
+			n = transform
+
+		default:
+			return n, nil
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package jexl
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string // Node.String()
+	}{
+		// precedence, && and || are the same level and left associative
+		{`a || b && c`, `a || b && c`},
+		{`a || (b && c)`, `a || (b && c)`},
+		{`a && b || c`, `a && b || c`},
+		{`1 + 2 * 3`, `1 + 2 * 3`},
+		{`(1 + 2) * 3`, `(1 + 2) * 3`},
+		{`a - b - c`, `a - b - c`},
+		{`a - (b - c)`, `a - (b - c)`},
+		{`2 ^ 3 * 4`, `2 ^ 3 * 4`},
+		{`a == b && c != d`, `a == b && c != d`},
+		{`a + 1 > b`, `a + 1 > b`},
+		{`a > 1 == true`, `a > 1 == true`},
+		{`"a" in ["a", "b"] && c`, `"a" in ["a", "b"] && c`},
+
+		// numbers and property access
+		{`.5`, `0.5`},
+		{`0.5`, `0.5`},
+		{`1.25 + .75`, `1.25 + 0.75`},
+		{`foo.bar`, `foo.bar`},
+		{`foo.bar.baz`, `foo.bar.baz`},
+		{`foo.in`, `foo.in`},
+		{`list[.5]`, `list[0.5]`},
+		{`list[0].name`, `list[0].name`},
+
+		// unary operators
+		{`-5`, `-5`},
+		{`- -5`, `5`},
+		{`-a`, `-a`},
+		{`-a.b`, `-a.b`},
+		{`2 - -1`, `2 - -1`},
+		{`!a`, `!a`},
+		{`!!a`, `!!a`},
+		{`!a && b`, `!a && b`},
+		{`!(a && b)`, `!(a && b)`},
+		{`-(1 + 2)`, `-(1 + 2)`},
+
+		// strings
+		{`'single'`, `"single"`},
+		{`"a\"b"`, `"a\"b"`},
+		{`'it\'s'`, `"it's"`},
+		{`"back\\slash"`, `"back\\slash"`},
+		{`"new\nline"`, `"new\nline"`},
+		{`'say "hi"'`, `"say \"hi\""`},
+
+		// transforms
+		{`a|lower`, `a|lower`},
+		{`a|lower()`, `a|lower`},
+		{`normandy.version|versionCompare("78.0") >= 0`, `normandy.version|versionCompare("78.0") >= 0`},
+		{`a|t(1, "x")|u`, `a|t(1, "x")|u`},
+		{`[normandy.userId]|stableSample(0.1)`, `[normandy.userId]|stableSample(0.1)`},
+		{`(a + b)|t`, `(a + b)|t`},
+		{`"pref"|preferenceValue(false) == true`, `"pref"|preferenceValue(false) == true`},
+
+		// filters and relative identifiers
+		{`addons[.id == "x"]`, `addons[.id == "x"]`},
+		{`addons[.id == "x" && .active].name`, `addons[.id == "x" && .active].name`},
+		{`a[b[.c == 1].d == .e]`, `a[b[.c == 1].d == .e]`},
+		{`obj["key"]`, `obj["key"]`},
+
+		// literals
+		{`[]`, `[]`},
+		{`[1, "a", true, null]`, `[1, "a", true, null]`},
+		{`{}`, `{}`},
+		{`{a: 1, "b c": [2]}`, `{"a": 1, "b c": [2]}`},
+
+		// ternary
+		{`a ? b : c`, `a ? b : c`},
+		{`a ? b : c ? d : e`, `a ? b : c ? d : e`},
+		{`(a ? b : c) ? d : e`, `(a ? b : c) ? d : e`},
+		{`a || b ? c : d`, `a || b ? c : d`},
+
+		// whitespace and new lines
+		{"a &&\n  b", `a && b`},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", test.src, err)
+			continue
+		}
+		if got := n.String(); got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.src, got, test.want)
+			continue
+		}
+
+		// the normalized form parses back to the same thing
+		again, err := Parse(test.want)
+		if err != nil || again.String() != test.want {
+			t.Errorf("Parse(%q) round trip = %v, %v", test.want, again, err)
+		}
+	}
+}
+
+// shape writes n as nested operators so tests can check how it grouped
+func shape(n Node) string {
+	switch n := n.(type) {
+	case *Binary:
+		return "(" + shape(n.Left) + " " + n.Op + " " + shape(n.Right) + ")"
+	case *Unary:
+		return "(" + n.Op + shape(n.Operand) + ")"
+	case *Conditional:
+		return "(" + shape(n.Test) + " ? " + shape(n.Consequent) + " : " + shape(n.Alternate) + ")"
+	}
+	return n.String()
+}
+
+func TestParsePrecedence(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`a || b && c`, `((a || b) && c)`},
+		{`a && b || c`, `((a && b) || c)`},
+		{`a || b || c`, `((a || b) || c)`},
+		{`a == b && c`, `((a == b) && c)`},
+		{`a in b == c`, `((a in b) == c)`},
+		{`1 + 2 * 3`, `(1 + (2 * 3))`},
+		{`1 * 2 + 3`, `((1 * 2) + 3)`},
+		{`2 ^ 3 * 4`, `((2 ^ 3) * 4)`},
+		{`a - b - c`, `((a - b) - c)`},
+		{`-a * b`, `((-a) * b)`},
+		{`!a == b`, `((!a) == b)`},
+		{`a ? b : c ? d : e`, `(a ? b : (c ? d : e))`},
+		{`a && b ? c : d`, `((a && b) ? c : d)`},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", test.src, err)
+			continue
+		}
+		if got := shape(n); got != test.want {
+			t.Errorf("Parse(%q) = %s, want %s", test.src, got, test.want)
+		}
+	}
+}
+
+func TestParseNodes(t *testing.T) {
+	pos := func(col int) Pos { return Pos{Offset: col - 1, Line: 1, Column: col} }
+
+	tests := []struct {
+		src  string
+		want Node
+	}{
+		{`.5`, &Literal{At: pos(1), Value: 0.5}},
+		{`-5`, &Literal{At: pos(1), Value: -5.0}},
+		{`-a`, &Unary{At: pos(1), Op: "-", Operand: &Identifier{At: pos(2), Name: "a"}}},
+		{`a.b`, &Identifier{At: pos(3), Name: "b", From: &Identifier{At: pos(1), Name: "a"}}},
+		{`'it\'s'`, &Literal{At: pos(1), Value: "it's"}},
+		{`a|t`, &Transform{At: pos(2), Name: "t", Subject: &Identifier{At: pos(1), Name: "a"}}},
+		{`a|t(1)`, &Transform{At: pos(2), Name: "t", Subject: &Identifier{At: pos(1), Name: "a"},
+			Args: []Node{&Literal{At: pos(5), Value: 1.0}}}},
+		{`a[.b]`, &Filter{At: pos(2), Subject: &Identifier{At: pos(1), Name: "a"},
+			Expr: &Identifier{At: pos(3), Name: "b", Relative: true}}},
+		{`a[.5]`, &Filter{At: pos(2), Subject: &Identifier{At: pos(1), Name: "a"},
+			Expr: &Literal{At: pos(3), Value: 0.5}}},
+	}
+
+	for _, test := range tests {
+		n, err := Parse(test.src)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", test.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(n, test.want) {
+			t.Errorf("Parse(%q) = %#v, want %#v", test.src, n, test.want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src    string
+		line   int
+		column int
+		msg    string
+	}{
+		{``, 1, 1, "empty expression"},
+		{`   `, 1, 4, "empty expression"},
+		{`a &&`, 1, 5, "unexpected end of expression"},
+		{`a b`, 1, 3, `unexpected "b"`},
+		{"a ==\n  @", 2, 3, `unexpected character '@'`},
+		{`"abc`, 1, 1, "unterminated string"},
+		{`x == 'abc\'`, 1, 6, "unterminated string"},
+		{`(a`, 1, 3, `expected ")", got end of expression`},
+		{`[1, 2`, 1, 6, `expected "," or "]", got end of expression`},
+		{`[1 2]`, 1, 4, `expected "," or "]", got "2"`},
+		{`{1: 2}`, 1, 2, `expected object key, got "1"`},
+		{`{a 1}`, 1, 4, `expected ":", got "1"`},
+		{`.foo`, 1, 1, `unexpected "."`},
+		{`a.`, 1, 3, "expected identifier, got end of expression"},
+		{`a|`, 1, 3, "expected transform name, got end of expression"},
+		{`a|1`, 1, 3, `expected transform name, got "1"`},
+		{`a ? b`, 1, 6, `expected ":", got end of expression`},
+		{`a[1`, 1, 4, `expected "]", got end of expression`},
+		{`a )`, 1, 3, `unexpected ")"`},
+		{"a &&\nb &&\n  ||", 3, 3, `unexpected "||"`},
+	}
+
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		e, ok := err.(*Error)
+		if !ok {
+			t.Errorf("Parse(%q) error = %v, want a *Error", test.src, err)
+			continue
+		}
+		if e.Pos.Line != test.line || e.Pos.Column != test.column || e.Msg != test.msg {
+			t.Errorf("Parse(%q) error = %s %q, want line %d col %d %q",
+				test.src, e.Pos, e.Msg, test.line, test.column, test.msg)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package jexl
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// Sampling is done the same way as Firefox's Sampling.jsm: the input is
+// JSON.stringify'd, hashed with sha256 and the first 48 bits of the hash, as
+// hex, are compared to fractions of 2^48 - 1 also written as hex.
+
+const (
+	hashBits   = 48
+	hashLength = hashBits / 4
+)
+
+var hashMultiplier = math.Pow(2, hashBits) - 1
+
+// SampleKey is the truncated hash of input
+func SampleKey(input interface{}) (string, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false) // JSON.stringify doesn't escape <, > and &
+	if err := enc.Encode(input); err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(bytes.TrimRight(buf.Bytes(), "\n"))
+	return hex.EncodeToString(sum[:])[:hashLength], nil
+}
+
+// FractionToKey turns a fraction (0 to 1) into a key to compare hashes to
+func FractionToKey(frac float64) (string, error) {
+	if frac < 0 || frac > 1 {
+		return "", fmt.Errorf("fraction %g is not between 0 and 1", frac)
+	}
+	return fmt.Sprintf("%0*x", hashLength, int64(math.Floor(frac*hashMultiplier))), nil
+}
+
+// StableSample is true when key is in the first rate (0 to 1) of the hashes
+func StableSample(key string, rate float64) (bool, error) {
+	point, err := FractionToKey(rate)
+	if err != nil {
+		return false, err
+	}
+	return key < point, nil
+}
+
+// BucketSample is true when key falls in the count buckets from start when
+// the hashes are split into total buckets.  Ranges past total wrap around.
+func BucketSample(key string, start, count, total float64) (bool, error) {
+	if total <= 0 {
+		return false, fmt.Errorf("total %g is not positive", total)
+	}
+
+	start = math.Mod(start, total)
+	end := start + count
+
+	if end > total {
+		in, err := inBucket(key, 0, math.Mod(end, total), total)
+		if in || err != nil {
+			return in, err
+		}
+		return inBucket(key, start, total, total)
+	}
+	return inBucket(key, start, end, total)
+}
+
+func inBucket(key string, min, max, total float64) (bool, error) {
+	minKey, err := FractionToKey(min / total)
+	if err != nil {
+		return false, err
+	}
+	maxKey, err := FractionToKey(max / total)
+	if err != nil {
+		return false, err
+	}
+	return minKey <= key && key < maxKey, nil
+}
@@ -0,0 +1,143 @@
+package jexl
+
+import "testing"
+
+// The known values are from Firefox's Sampling.jsm and its tests,
+// toolkit/components/utils/test/unit/test_Sampling.js
+
+func TestSampleKey(t *testing.T) {
+	tests := []struct {
+		input interface{}
+		want  string
+	}{
+		// sha256 of the JSON.stringify'd input
+		{"test", "4d967a30111b"},
+		{"test-0", "782843000477"},
+		{"test-1", "887a83b78786"},
+		{[]interface{}{"ns", "user-1"}, "f1dea6e0f2f7"},
+		{[]interface{}{1.0, "a"}, "2010945388e2"},
+		{"<&>", "9e7b000e9d48"},
+	}
+
+	for _, test := range tests {
+		got, err := SampleKey(test.input)
+		if err != nil {
+			t.Errorf("SampleKey(%#v) error: %v", test.input, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("SampleKey(%#v) = %s, want %s", test.input, got, test.want)
+		}
+	}
+}
+
+func TestFractionToKey(t *testing.T) {
+	tests := []struct {
+		frac float64
+		want string
+	}{
+		{0, "000000000000"},
+		{0.5, "7fffffffffff"},
+		{1, "ffffffffffff"},
+		{0.25, "3fffffffffff"},
+	}
+
+	for _, test := range tests {
+		got, err := FractionToKey(test.frac)
+		if err != nil || got != test.want {
+			t.Errorf("FractionToKey(%g) = %s, %v, want %s", test.frac, got, err, test.want)
+		}
+	}
+
+	for _, frac := range []float64{-0.1, 1.1} {
+		if _, err := FractionToKey(frac); err == nil {
+			t.Errorf("FractionToKey(%g) didn't fail", frac)
+		}
+	}
+}
+
+func TestStableSample(t *testing.T) {
+	tests := []struct {
+		input string
+		rate  float64
+		want  bool
+	}{
+		{"test", 1, true},
+		{"test", 0, false},
+		{"test-0", 0.5, true},
+		{"test-1", 0.5, false},
+	}
+
+	for _, test := range tests {
+		key, _ := SampleKey(test.input)
+		if got, err := StableSample(key, test.rate); got != test.want || err != nil {
+			t.Errorf("StableSample(%q, %g) = %v, %v, want %v", test.input, test.rate, got, err, test.want)
+		}
+	}
+}
+
+func TestBucketSample(t *testing.T) {
+	tests := []struct {
+		input               string
+		start, count, total float64
+		want                bool
+	}{
+		{"test", 0, 10, 10, true},
+		{"test", 0, 0, 10, false},
+		{"test-0", 0, 5, 10, true},
+		{"test-2", 0, 5, 10, false},
+	}
+
+	for _, test := range tests {
+		key, _ := SampleKey(test.input)
+		got, err := BucketSample(key, test.start, test.count, test.total)
+		if got != test.want || err != nil {
+			t.Errorf("BucketSample(%q, %g, %g, %g) = %v, %v, want %v",
+				test.input, test.start, test.count, test.total, got, err, test.want)
+		}
+	}
+
+	if _, err := BucketSample("000000000000", 0, 1, 0); err == nil {
+		t.Error("BucketSample with a total of 0 didn't fail")
+	}
+}
+
+func TestBucketSampleWrapAround(t *testing.T) {
+	// the key in the middle of each of 10 buckets
+	bucket := func(b int) string {
+		key, err := FractionToKey((float64(b) + 0.5) / 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+
+	tests := []struct {
+		start, count float64
+		want         []int // the buckets matched
+	}{
+		{0, 3, []int{0, 1, 2}},
+		{8, 2, []int{8, 9}},
+		{8, 4, []int{0, 1, 8, 9}},
+		{9, 10, []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}},
+		{18, 4, []int{0, 1, 8, 9}}, // start wraps too
+		{10, 1, []int{0}},
+	}
+
+	for _, test := range tests {
+		want := map[int]bool{}
+		for _, b := range test.want {
+			want[b] = true
+		}
+
+		for b := 0; b < 10; b++ {
+			got, err := BucketSample(bucket(b), test.start, test.count, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want[b] {
+				t.Errorf("BucketSample(bucket %d, %g, %g, 10) = %v, want %v", b, test.start, test.count, got, want[b])
+			}
+		}
+	}
+}
@@ -0,0 +1,390 @@
+package jexl
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mostlygeek/normandy-tools/tools"
+)
+
+// Translation is an expression turned into the filter objects that target the
+// same clients.  Residual is what couldn't be translated and still has to be
+// an extra_filter_expression, nil when everything was translated.
+type Translation struct {
+	FilterObjects []tools.FilterObject
+	Residual      Node
+}
+
+type Convertibility string
+
+const (
+	FullyConvertible     Convertibility = "fully convertible"
+	PartiallyConvertible Convertibility = "partially convertible"
+	NotConvertible       Convertibility = "not convertible"
+)
+
+func (t Translation) Convertibility() Convertibility {
+	switch {
+	case len(t.FilterObjects) == 0:
+		return NotConvertible
+	case t.Residual != nil:
+		return PartiallyConvertible
+	}
+	return FullyConvertible
+}
+
+// presets are the clauses Normandy expands its preset filter objects into
+var presets = map[string][]string{
+	"pocket-1": {
+		`"browser.newtabpage.activity-stream.feeds.section.topstories"|preferenceValue == true`,
+		`"browser.newtabpage.activity-stream.feeds.system.topstories"|preferenceValue == true`,
+		`!("browser.newtabpage.enabled"|preferenceIsUserSet)`,
+		`!("browser.startup.homepage"|preferenceIsUserSet)`,
+	},
+	"pocket-2": {
+		`"browser.newtabpage.activity-stream.feeds.section.topstories"|preferenceValue == true`,
+		`"browser.newtabpage.activity-stream.feeds.system.topstories"|preferenceValue == true`,
+		`"browser.newtabpage.activity-stream.showSponsored"|preferenceValue == true`,
+		`!("browser.newtabpage.enabled"|preferenceIsUserSet)`,
+		`!("browser.startup.homepage"|preferenceIsUserSet)`,
+	},
+}
+
+// filterObjectOrder is the order filter objects come out in, the order
+// they're usually written in
+var filterObjectOrder = []string{
+	"channel", "locale", "country", "version", "versionRange",
+	"bucketSample", "stableSample", "namespaceSample", "presets",
+}
+
+// lists are the filter objects that are a context value in a list of strings
+var lists = []struct {
+	field  string // the normandy context field
+	filter func(values []string) tools.Filter
+}{
+	{"channel", func(v []string) tools.Filter { return &tools.ChannelFilter{Channels: v} }},
+	{"locale", func(v []string) tools.Filter { return &tools.LocaleFilter{Locales: v} }},
+	{"country", func(v []string) tools.Filter { return &tools.CountryFilter{Countries: v} }},
+}
+
+// Translate turns the top level && clauses of n into filter objects where it
+// can.  Clauses are only translated when the filter object targets exactly
+// the same clients, ie: versionCompare("78.0") >= 0 is left alone as there
+// isn't a filter object for "78.0 and later".
+func Translate(n Node) Translation {
+	var t Translation
+	if n == nil {
+		return t
+	}
+
+	clauses := Clauses(Canonical(n))
+	found := make(map[string]tools.FilterObject)
+	add := func(fo tools.FilterObject) bool {
+		if _, ok := found[fo.Type]; ok {
+			return false
+		}
+		found[fo.Type] = fo
+		return true
+	}
+
+	clauses = matchPresets(clauses, add)
+
+	var residual, lower, upper []Node
+	for _, c := range clauses {
+		if bound, _, ok := versionBound(c); ok {
+			if bound == ">=" {
+				lower = append(lower, c)
+			} else {
+				upper = append(upper, c)
+			}
+			continue
+		}
+
+		if fo, ok := translateClause(c); ok && add(fo) {
+			continue
+		}
+		residual = append(residual, c)
+	}
+
+	// a version range needs both ends
+	if len(lower) == 1 && len(upper) == 1 {
+		_, min, _ := versionBound(lower[0])
+		_, max, _ := versionBound(upper[0])
+		if add(versionFilter(min, max)) {
+			lower, upper = nil, nil
+		}
+	}
+	residual = append(append(residual, lower...), upper...)
+
+	for _, typ := range filterObjectOrder {
+		if fo, ok := found[typ]; ok {
+			t.FilterObjects = append(t.FilterObjects, fo)
+		}
+	}
+
+	if len(residual) > 0 {
+		sortNodes(residual)
+		t.Residual = chain(n.Pos(), "&&", residual)
+	}
+	return t
+}
+
+// matchPresets replaces the clauses of any preset found in clauses with the
+// preset filter object
+func matchPresets(clauses []Node, add func(tools.FilterObject) bool) []Node {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+
+	// the largest preset first, pocket-2 includes all of pocket-1
+	sort.Slice(names, func(i, j int) bool {
+		if len(presets[names[i]]) != len(presets[names[j]]) {
+			return len(presets[names[i]]) > len(presets[names[j]])
+		}
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		have := make(map[string]bool, len(clauses))
+		for _, c := range clauses {
+			have[c.String()] = true
+		}
+
+		want := make(map[string]bool)
+		for _, src := range presets[name] {
+			want[Canonical(MustParse(src)).String()] = true
+		}
+
+		matched := true
+		for w := range want {
+			if !have[w] {
+				matched = false
+				break
+			}
+		}
+
+		if !matched || !add(tools.NewFilterObject(&tools.PresetFilter{Name: name})) {
+			continue
+		}
+
+		var rest []Node
+		for _, c := range clauses {
+			if !want[c.String()] {
+				rest = append(rest, c)
+			}
+		}
+		clauses = rest
+	}
+
+	return clauses
+}
+
+// translateClause turns a single clause into a filter object
+func translateClause(n Node) (tools.FilterObject, bool) {
+	for _, l := range lists {
+		if values, ok := contextList(n, l.field); ok {
+			return tools.NewFilterObject(l.filter(values)), true
+		}
+	}
+
+	if versions, ok := versionList(n); ok {
+		return tools.NewFilterObject(&tools.VersionFilter{Versions: versions}), true
+	}
+
+	return sampleFilter(n)
+}
+
+// contextPath returns the name of the normandy context value n looks up,
+// ie: "channel" for normandy.channel, or "" if it isn't one
+func contextPath(n Node) string {
+	id, ok := n.(*Identifier)
+	if !ok {
+		return ""
+	}
+
+	for _, prefix := range []string{"normandy.", "env."} {
+		if p := id.Path(); strings.HasPrefix(p, prefix) {
+			return strings.TrimPrefix(p, prefix)
+		}
+	}
+	return ""
+}
+
+// contextList matches normandy.field == "a" and normandy.field in ["a", "b"]
+func contextList(n Node, field string) ([]string, bool) {
+	b, ok := n.(*Binary)
+	if !ok {
+		return nil, false
+	}
+
+	switch b.Op {
+	case "==":
+		for _, sides := range [][2]Node{{b.Left, b.Right}, {b.Right, b.Left}} {
+			if s, ok := stringLiteral(sides[1]); ok && contextPath(sides[0]) == field {
+				return []string{s}, true
+			}
+		}
+
+	case "in":
+		arr, ok := b.Right.(*Array)
+		if !ok || contextPath(b.Left) != field || len(arr.Elements) == 0 {
+			return nil, false
+		}
+
+		values := make([]string, len(arr.Elements))
+		for i, e := range arr.Elements {
+			if values[i], ok = stringLiteral(e); !ok {
+				return nil, false
+			}
+		}
+		return values, true
+	}
+
+	return nil, false
+}
+
+// versionBound matches normandy.version|versionCompare("X") >= 0 and
+// normandy.version|versionCompare("X") < 0, returning the operator and X
+func versionBound(n Node) (string, string, bool) {
+	b, ok := n.(*Binary)
+	if !ok || b.Op != ">=" && b.Op != "<" {
+		return "", "", false
+	}
+
+	if zero, ok := numberLiteral(b.Right); !ok || zero != 0 {
+		return "", "", false
+	}
+
+	t, ok := b.Left.(*Transform)
+	if !ok || t.Name != "versionCompare" || len(t.Args) != 1 || contextPath(t.Subject) != "version" {
+		return "", "", false
+	}
+
+	version, ok := stringLiteral(t.Args[0])
+	return b.Op, version, ok
+}
+
+// versionList matches the expression Normandy writes for a version filter
+// object, a || chain of ranges covering each major version:
+// (versionCompare("78.!") >= 0 && versionCompare("78.*") < 0) || ...
+func versionList(n Node) ([]int, bool) {
+	b, ok := n.(*Binary)
+	if !ok || b.Op != "||" {
+		return nil, false
+	}
+
+	var versions []int
+	for _, o := range flatten(b, "||") {
+		bounds := flatten(o, "&&")
+		if len(bounds) != 2 {
+			return nil, false
+		}
+
+		op1, v1, ok1 := versionBound(bounds[0])
+		op2, v2, ok2 := versionBound(bounds[1])
+		if !ok1 || !ok2 || op1 == op2 {
+			return nil, false
+		}
+		if op1 == "<" {
+			v1, v2 = v2, v1
+		}
+
+		min, ok1 := majorVersion(v1, ".!")
+		max, ok2 := majorVersion(v2, ".*")
+		if !ok1 || !ok2 || min != max {
+			return nil, false
+		}
+		versions = append(versions, min)
+	}
+
+	sort.Ints(versions)
+	return versions, true
+}
+
+// versionFilter is the filter object for versions from min up to max.  Whole
+// major versions, "77.!" up to "78.*", are a version filter, anything else
+// is a version range.
+func versionFilter(min, max string) tools.FilterObject {
+	first, ok1 := majorVersion(min, ".!")
+	last, ok2 := majorVersion(max, ".*")
+	if ok1 && ok2 && first <= last {
+		var versions []int
+		for v := first; v <= last; v++ {
+			versions = append(versions, v)
+		}
+		return tools.NewFilterObject(&tools.VersionFilter{Versions: versions})
+	}
+
+	return tools.NewFilterObject(&tools.VersionRangeFilter{MinVersion: min, MaxVersion: max})
+}
+
+// majorVersion parses versions like "78.!" where suffix is ".!"
+func majorVersion(version, suffix string) (int, bool) {
+	if !strings.HasSuffix(version, suffix) {
+		return 0, false
+	}
+	v, err := strconv.Atoi(strings.TrimSuffix(version, suffix))
+	return v, err == nil
+}
+
+// sampleFilter matches [inputs]|bucketSample(start, count, total) and
+// [inputs]|stableSample(rate).  A bucketSample over ["namespace",
+// normandy.userId] with 10000 buckets is what a namespaceSample filter
+// object is written as.
+func sampleFilter(n Node) (tools.FilterObject, bool) {
+	t, ok := n.(*Transform)
+	if !ok {
+		return tools.FilterObject{}, false
+	}
+
+	input, ok := t.Subject.(*Array)
+	if !ok || len(input.Elements) == 0 {
+		return tools.FilterObject{}, false
+	}
+
+	args := make([]float64, len(t.Args))
+	for i, a := range t.Args {
+		if args[i], ok = numberLiteral(a); !ok {
+			return tools.FilterObject{}, false
+		}
+	}
+
+	inputs := make([]string, len(input.Elements))
+	for i, e := range input.Elements {
+		inputs[i] = e.String()
+	}
+
+	switch {
+	case t.Name == "stableSample" && len(args) == 1:
+		return tools.NewFilterObject(&tools.StableSampleFilter{Input: inputs, Rate: args[0]}), true
+
+	case t.Name == "bucketSample" && len(args) == 3:
+		if len(input.Elements) == 2 && args[2] == tools.NamespaceBuckets && contextPath(input.Elements[1]) == "userId" {
+			if namespace, ok := stringLiteral(input.Elements[0]); ok {
+				return tools.NewFilterObject(&tools.NamespaceSampleFilter{Namespace: namespace, Start: args[0], Count: args[1]}), true
+			}
+		}
+
+		return tools.NewFilterObject(&tools.BucketSampleFilter{Input: inputs, Start: args[0], Count: args[1], Total: args[2]}), true
+	}
+
+	return tools.FilterObject{}, false
+}
+
+func stringLiteral(n Node) (string, bool) {
+	if lit, ok := n.(*Literal); ok {
+		s, ok := lit.Value.(string)
+		return s, ok
+	}
+	return "", false
+}
+
+func numberLiteral(n Node) (float64, bool) {
+	if lit, ok := n.(*Literal); ok {
+		f, ok := lit.Value.(float64)
+		return f, ok
+	}
+	return 0, false
+}
@@ -0,0 +1,274 @@
+package jexl
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+const (
+	versionBetween = `normandy.version|versionCompare(%q) >= 0 && normandy.version|versionCompare(%q) < 0`
+	pocket1        = `"browser.newtabpage.activity-stream.feeds.section.topstories"|preferenceValue == true && ` +
+		`"browser.newtabpage.activity-stream.feeds.system.topstories"|preferenceValue == true && ` +
+		`!("browser.newtabpage.enabled"|preferenceIsUserSet) && !("browser.startup.homepage"|preferenceIsUserSet)`
+)
+
+func between(min, max string) string {
+	return fmt.Sprintf(versionBetween, min, max)
+}
+
+var translateTests = []struct {
+	src      string
+	filters  []string // filter objects as JSON
+	residual string
+}{
+	{
+		src:     `normandy.channel == "release"`,
+		filters: []string{`{"channels":["release"],"type":"channel"}`},
+	},
+	{
+		src:     `"release" == env.channel`,
+		filters: []string{`{"channels":["release"],"type":"channel"}`},
+	},
+	{
+		src: `normandy.channel in ["release", "beta"] && normandy.locale == "en-US" && normandy.country in ["US", "CA"]`,
+		filters: []string{
+			`{"channels":["beta","release"],"type":"channel"}`,
+			`{"locales":["en-US"],"type":"locale"}`,
+			`{"countries":["CA","US"],"type":"country"}`,
+		},
+	},
+	{
+		// only one filter object of a type, the other clause still applies
+		src:      `normandy.channel == "release" && normandy.channel == "beta"`,
+		filters:  []string{`{"channels":["beta"],"type":"channel"}`},
+		residual: `"release" == normandy.channel`,
+	},
+	{src: `normandy.channel != "release"`, residual: `"release" != normandy.channel`},
+	{src: `!(normandy.channel == "release")`, residual: `!("release" == normandy.channel)`},
+	{src: `normandy.channel == "release" || normandy.channel == "beta"`, residual: `"beta" == normandy.channel || "release" == normandy.channel`},
+	{src: `normandy.channel in []`, residual: `normandy.channel in []`},
+	{src: `normandy.channel in ["release", 1]`, residual: `normandy.channel in ["release", 1]`},
+	{src: `normandy.channel in "release-cck"`, residual: `normandy.channel in "release-cck"`},
+	{src: `normandy.channel == normandy.locale`, residual: `normandy.channel == normandy.locale`},
+	{
+		src:     between("70.!", "78.*"),
+		filters: []string{`{"type":"version","versions":[70,71,72,73,74,75,76,77,78]}`},
+	},
+	{
+		src:     between("70.0", "78.0"),
+		filters: []string{`{"max_version":"78.0","min_version":"70.0","type":"versionRange"}`},
+	},
+	{
+		// a single bound has no filter object
+		src:      `normandy.version|versionCompare("70.0") >= 0`,
+		residual: `normandy.version|versionCompare("70.0") >= 0`,
+	},
+	{
+		src:      between("70.0", "78.0") + ` && normandy.version|versionCompare("72.0") >= 0`,
+		residual: `normandy.version|versionCompare("70.0") >= 0 && normandy.version|versionCompare("72.0") >= 0 && normandy.version|versionCompare("78.0") < 0`,
+	},
+	{
+		src:     "(" + between("77.!", "77.*") + ") || (" + between("78.!", "78.*") + ")",
+		filters: []string{`{"type":"version","versions":[77,78]}`},
+	},
+	{
+		// not a whole major version
+		src:      "(" + between("77.!", "78.*") + ") || (" + between("79.!", "79.*") + ")",
+		residual: between("77.!", "78.*") + " || (" + between("79.!", "79.*") + ")",
+	},
+	{
+		src:     `[normandy.userId, "ns"]|bucketSample(0, 100, 10000)`,
+		filters: []string{`{"count":100,"input":["normandy.userId","\"ns\""],"start":0,"total":10000,"type":"bucketSample"}`},
+	},
+	{
+		src:     `["ns", normandy.userId]|bucketSample(9950, 100, 10000)`,
+		filters: []string{`{"count":100,"namespace":"ns","start":9950,"type":"namespaceSample"}`},
+	},
+	{
+		src:     `["ns", normandy.userId]|bucketSample(10, 20, 1000)`,
+		filters: []string{`{"count":20,"input":["\"ns\"","normandy.userId"],"start":10,"total":1000,"type":"bucketSample"}`},
+	},
+	{
+		src:      `[normandy.userId]|stableSample(0.5) && normandy.channel == "release" && "x"|preferenceValue == 1`,
+		filters:  []string{`{"channels":["release"],"type":"channel"}`, `{"input":["normandy.userId"],"rate":0.5,"type":"stableSample"}`},
+		residual: `"x"|preferenceValue == 1`,
+	},
+	{src: `[normandy.userId]|stableSample(0.5, 1)`, residual: `[normandy.userId]|stableSample(0.5, 1)`},
+	{src: `[]|stableSample(0.5)`, residual: `[]|stableSample(0.5)`},
+	{
+		src:     pocket1 + ` && normandy.channel == "release"`,
+		filters: []string{`{"channels":["release"],"type":"channel"}`, `{"name":"pocket-1","type":"presets"}`},
+	},
+	{
+		// part of a preset isn't the preset
+		src:      `"browser.newtabpage.activity-stream.feeds.section.topstories"|preferenceValue == true`,
+		residual: `"browser.newtabpage.activity-stream.feeds.section.topstories"|preferenceValue == true`,
+	},
+	{
+		src: `normandy.locale == "en-US" && ` + between("70.!", "70.*") + ` && normandy.isDefaultBrowser`,
+		filters: []string{
+			`{"locales":["en-US"],"type":"locale"}`,
+			`{"type":"version","versions":[70]}`,
+		},
+		residual: `normandy.isDefaultBrowser`,
+	},
+}
+
+func TestTranslate(t *testing.T) {
+	for _, test := range translateTests {
+		tr := Translate(MustParse(test.src))
+
+		var got []string
+		for _, fo := range tr.FilterObjects {
+			got = append(got, string(fo.Raw))
+		}
+		if strings.Join(got, "\n") != strings.Join(test.filters, "\n") {
+			t.Errorf("Translate(%s) filter objects:\n%s\nwant:\n%s", test.src, strings.Join(got, "\n"), strings.Join(test.filters, "\n"))
+		}
+
+		residual := ""
+		if tr.Residual != nil {
+			residual = tr.Residual.String()
+		}
+		if residual != test.residual {
+			t.Errorf("Translate(%s) residual = %s, want %s", test.src, residual, test.residual)
+		}
+
+		// and the filter objects are ones Normandy would take
+		for _, fo := range tr.FilterObjects {
+			f, err := fo.DecodeStrict()
+			if err == nil {
+				err = f.Validate()
+			}
+			if err != nil {
+				t.Errorf("Translate(%s) made a bad filter object %s: %v", test.src, fo.Raw, err)
+			}
+		}
+	}
+}
+
+func TestTranslateConvertibility(t *testing.T) {
+	tests := []struct {
+		src  string
+		want Convertibility
+	}{
+		{`normandy.channel == "release"`, FullyConvertible},
+		{`normandy.channel == "release" && normandy.isDefaultBrowser`, PartiallyConvertible},
+		{`normandy.isDefaultBrowser`, NotConvertible},
+	}
+
+	for _, test := range tests {
+		if got := Translate(MustParse(test.src)).Convertibility(); got != test.want {
+			t.Errorf("Translate(%s) is %s, want %s", test.src, got, test.want)
+		}
+	}
+
+	if got := Translate(nil).Convertibility(); got != NotConvertible {
+		t.Errorf("Translate(nil) is %s, want %s", got, NotConvertible)
+	}
+}
+
+// clients is every combination of the context values the translated
+// expressions look at
+func clients() []*Client {
+	var list []*Client
+	prefs := []struct {
+		values  map[string]interface{}
+		userSet []string
+	}{
+		{},
+		{values: map[string]interface{}{
+			"browser.newtabpage.activity-stream.feeds.section.topstories": true,
+			"browser.newtabpage.activity-stream.feeds.system.topstories":  true,
+			"x": 1.0,
+		}},
+		{values: map[string]interface{}{
+			"browser.newtabpage.activity-stream.feeds.section.topstories": true,
+			"browser.newtabpage.activity-stream.feeds.system.topstories":  true,
+		}, userSet: []string{"browser.startup.homepage"}},
+	}
+
+	for _, channel := range []string{"release", "beta", "nightly"} {
+		for _, locale := range []string{"en-US", "de"} {
+			for _, country := range []string{"US", "CA", "DE"} {
+				for _, version := range []string{"69.0", "70.0", "70.0.1", "71.0a1", "77.0", "78.0", "78.0.2", "79.0"} {
+					for p, pref := range prefs {
+						for u := 0; u < 12; u++ {
+							list = append(list, &Client{
+								UserID:             fmt.Sprintf("user-%d-%d-%s", u, p, version),
+								Version:            version,
+								Channel:            channel,
+								Locale:             locale,
+								Country:            country,
+								Preferences:        pref.values,
+								UserSetPreferences: pref.userSet,
+								Extra:              map[string]interface{}{"isDefaultBrowser": u%2 == 0},
+							})
+						}
+					}
+				}
+			}
+		}
+	}
+	return list
+}
+
+func matchesTranslation(c *Client, ev *Evaluator, tr Translation) (bool, error) {
+	for _, fo := range tr.FilterObjects {
+		f, err := fo.Decode()
+		if err != nil {
+			return false, err
+		}
+		if ok, err := c.MatchFilter(ev, f); !ok || err != nil {
+			return false, err
+		}
+	}
+
+	if tr.Residual == nil {
+		return true, nil
+	}
+	return ev.Match(tr.Residual)
+}
+
+// TestTranslateTargeting checks the translated filter objects and residual
+// expression never target a client the original expression doesn't, and the
+// other way around.
+func TestTranslateTargeting(t *testing.T) {
+	list := clients()
+
+	for _, test := range translateTests {
+		n := MustParse(test.src)
+		tr := Translate(n)
+
+		extra, missing, matched := 0, 0, 0
+		for _, c := range list {
+			ev := c.Evaluator(1, nil)
+			want, err := ev.Match(n)
+			if err != nil {
+				t.Fatalf("%s: %v", test.src, err)
+			}
+			got, err := matchesTranslation(c, ev, tr)
+			if err != nil {
+				t.Fatalf("%s: %v", test.src, err)
+			}
+
+			switch {
+			case got && !want:
+				extra++
+			case want && !got:
+				missing++
+			case want:
+				matched++
+			}
+		}
+
+		if extra > 0 {
+			t.Errorf("Translate(%s) targets %d clients the expression doesn't", test.src, extra)
+		}
+		if missing > 0 {
+			t.Errorf("Translate(%s) misses %d clients the expression targets", test.src, missing)
+		}
+		t.Logf("%d of %d clients match %s", matched, len(list), test.src)
+	}
+}
@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// CacheEntry is a cached response and what's needed to revalidate it
+type CacheEntry struct {
+	URL          string    `json:"url"`
+	Body         []byte    `json:"-"`
+	Fetched      time.Time `json:"fetched"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+}
+
+// fresh is true if the entry can be used without asking the server
+func (e *CacheEntry) fresh(now time.Time) bool {
+	return !e.Fetched.IsZero() && now.Sub(e.Fetched) < CacheMaxAge
+}
+
+// Cache stores responses for Get
+type Cache interface {
+	Get(url string) (*CacheEntry, bool)
+	Set(url string, entry *CacheEntry) error
+}
+
+// CacheDirEnv is the environment variable that overrides the default cache dir
+const CacheDirEnv = "NORMANDY_TOOLS_CACHE_DIR"
+
+// DefaultCacheDir is $NORMANDY_TOOLS_CACHE_DIR if it is set, otherwise a
+// normandy-tools dir in the user's cache dir ($XDG_CACHE_HOME, ~/.cache, etc)
+func DefaultCacheDir() string {
+	if dir := os.Getenv(CacheDirEnv); dir != "" {
+		return dir
+	}
+
+	if dir, err := os.UserCacheDir(); err == nil {
+		return filepath.Join(dir, "normandy-tools")
+	}
+
+	return filepath.Join(os.TempDir(), "normandy-tools-cache")
+}
+
+// OpenCache creates a cache by type: "fs", "memory" or "none".  dir is only
+// used by "fs", empty means DefaultCacheDir().
+func OpenCache(kind, dir string) (Cache, error) {
+	switch kind {
+	case "fs", "":
+		if dir == "" {
+			dir = DefaultCacheDir()
+		}
+		return NewDirCache(dir)
+	case "memory":
+		return NewMemoryCache(), nil
+	case "none":
+		return NoCache{}, nil
+	default:
+		return nil, errors.Errorf("Unknown cache type: %s", kind)
+	}
+}
+
+var (
+	cacheLock sync.Mutex
+	cache     Cache
+)
+
+// SetCache changes the cache used by Get
+func SetCache(c Cache) {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+	cache = c
+}
+
+// currentCache returns the cache used by Get, opening the default
+// filesystem cache the first time if SetCache was never called
+func currentCache() Cache {
+	cacheLock.Lock()
+	defer cacheLock.Unlock()
+
+	if cache == nil {
+		c, err := OpenCache("fs", "")
+		if err != nil {
+			Log.Warn("Not caching responses", "err", err)
+			c = NoCache{}
+		}
+		cache = c
+	}
+
+	return cache
+}
+
+// Cachedir is the directory of the filesystem cache, or "" when responses
+// aren't cached on disk
+func Cachedir() string {
+	if c, ok := currentCache().(*DirCache); ok {
+		return c.Dir
+	}
+	return ""
+}
+
+// DirCache keeps each response in a file named after the md5 of its url with
+// the metadata in a .meta file next to it
+type DirCache struct {
+	Dir string
+}
+
+func NewDirCache(dir string) (*DirCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "Failed creating cache dir")
+	}
+	return &DirCache{Dir: dir}, nil
+}
+
+func (c *DirCache) filename(url string) string {
+	h := md5.New()
+	io.WriteString(h, url)
+	return filepath.Join(c.Dir, hex.EncodeToString(h.Sum(nil)))
+}
+
+// Get returns the cached entry.  Bodies cached before metadata existed come
+// back without a fetch time, so they are always stale.
+func (c *DirCache) Get(url string) (*CacheEntry, bool) {
+	data, err := ioutil.ReadFile(c.filename(url))
+	if err != nil {
+		return nil, false
+	}
+
+	entry := &CacheEntry{URL: url}
+	if m, err := ioutil.ReadFile(c.filename(url) + ".meta"); err == nil {
+		json.Unmarshal(m, entry)
+	}
+
+	entry.Body = data
+	return entry, true
+}
+
+func (c *DirCache) Set(url string, entry *CacheEntry) error {
+	if err := ioutil.WriteFile(c.filename(url), entry.Body, 0644); err != nil {
+		return err
+	}
+
+	m, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(c.filename(url)+".meta", m, 0644)
+}
+
+// MemoryCache keeps responses for the life of the process
+type MemoryCache struct {
+	sync.Mutex
+	entries map[string]CacheEntry
+}
+
+func NewMemoryCache() *MemoryCache {
+	return &MemoryCache{
+		entries: make(map[string]CacheEntry),
+	}
+}
+
+func (c *MemoryCache) Get(url string) (*CacheEntry, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	entry, ok := c.entries[url]
+	if !ok {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (c *MemoryCache) Set(url string, entry *CacheEntry) error {
+	c.Lock()
+	defer c.Unlock()
+
+	c.entries[url] = *entry
+	return nil
+}
+
+// NoCache doesn't cache anything
+type NoCache struct{}
+
+func (NoCache) Get(url string) (*CacheEntry, bool)      { return nil, false }
+func (NoCache) Set(url string, entry *CacheEntry) error { return nil }
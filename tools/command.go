@@ -0,0 +1,136 @@
+package tools
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Command is a subcommand of the normandy-tools binary
+type Command struct {
+	Name string
+
+	// Usage is what goes after the command name, "[flags]" when empty
+	Usage string
+
+	// Short is a one line description for the command list, Long is the
+	// help text shown by -h
+	Short string
+	Long  string
+
+	// Setup registers the command's own flags on fs and returns the
+	// function that runs it.  The shared flags are added after Setup.
+	Setup func(fs *flag.FlagSet) func(ctx context.Context, args []string) error
+}
+
+// UsageError makes Main print the command's usage and exit with 2
+type UsageError struct {
+	Msg string
+}
+
+func (e *UsageError) Error() string {
+	return e.Msg
+}
+
+// Usagef returns a *UsageError
+func Usagef(format string, args ...interface{}) error {
+	return &UsageError{fmt.Sprintf(format, args...)}
+}
+
+// Main runs the command named in args[0] and returns the exit code
+func Main(program string, commands []*Command, args []string) int {
+	if len(args) == 0 {
+		printCommands(os.Stderr, program, commands)
+		return 2
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 {
+			// help <command> is <command> -h
+			return Main(program, commands, []string{args[1], "-h"})
+		}
+		printCommands(os.Stdout, program, commands)
+		return 0
+	}
+
+	for _, cmd := range commands {
+		if cmd.Name == name {
+			return run(program, cmd, args[1:])
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", name)
+	printCommands(os.Stderr, program, commands)
+	return 2
+}
+
+func run(program string, cmd *Command, args []string) int {
+	fs := flag.NewFlagSet(program+" "+cmd.Name, flag.ContinueOnError)
+	runner := cmd.Setup(fs)
+	AddFlags(fs)
+
+	usage := cmd.Usage
+	if usage == "" {
+		usage = "[flags]"
+	}
+
+	fs.Usage = func() {
+		w := fs.Output()
+		fmt.Fprintf(w, "Usage: %s %s %s\n\n", program, cmd.Name, usage)
+		fmt.Fprintln(w, strings.TrimSpace(cmd.Long))
+		fmt.Fprintln(w, "\nFlags:")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return 0
+		}
+		return 2
+	}
+
+	if err := ApplyFlags(); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		fs.Usage()
+		return 2
+	}
+
+	// tell about anything that could not be fetched so reports are not
+	// silently missing data
+	defer PrintFailures(os.Stderr)
+
+	ctx, cancel := SignalContext()
+	defer cancel()
+
+	err := runner(ctx, fs.Args())
+
+	var usageErr *UsageError
+	if errors.As(err, &usageErr) {
+		fmt.Fprintln(os.Stderr, usageErr.Msg)
+		fs.Usage()
+		return 2
+	} else if err != nil {
+		Log.Error(err.Error())
+		return 1
+	}
+	return 0
+}
+
+func printCommands(w io.Writer, program string, commands []*Command) {
+	fmt.Fprintf(w, "Usage: %s <command> [flags]\n\nCommands:\n", program)
+
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.Name, cmd.Short)
+	}
+	tw.Flush()
+
+	fmt.Fprintf(w, "\nUse \"%s help <command>\" for a command's help and flags.\n", program)
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Environment is a Normandy server to talk to
+type Environment struct {
+	// BaseURL is the root of the v3 API, ending in /
+	BaseURL string `json:"base_url"`
+
+	// Headers are sent with every request, ie: an Authorization header
+	Headers map[string]string `json:"headers"`
+}
+
+const (
+	// EnvironmentEnv selects the environment when -env isn't used
+	EnvironmentEnv = "NORMANDY_TOOLS_ENV"
+
+	// ConfigEnv is the path of the config file, by default it's
+	// normandy-tools/config.json in the user config dir
+	ConfigEnv = "NORMANDY_TOOLS_CONFIG"
+
+	DefaultEnvironment = "prod"
+)
+
+// Environments are the known environments by name.  The config file can
+// change them or add more:
+//
+//	{"environments": {"dev": {"base_url": "https://localhost:8000/api/v3/", "headers": {"Authorization": "Bearer ..."}}}}
+var Environments = map[string]*Environment{
+	"prod":     {BaseURL: "https://normandy.cdn.mozilla.net/api/v3/"},
+	"prod-api": {BaseURL: "https://normandy.services.mozilla.com/api/v3/"},
+	"stage":    {BaseURL: "https://stage.normandy.nonprod.cloudops.mozgcp.net/api/v3/"},
+	"dev":      {BaseURL: "http://localhost:8000/api/v3/"},
+}
+
+var currentEnvironment = Environments[DefaultEnvironment]
+
+// DefaultConfigFile returns $NORMANDY_TOOLS_CONFIG or config.json in the
+// user config dir
+func DefaultConfigFile() string {
+	if path := os.Getenv(ConfigEnv); path != "" {
+		return path
+	}
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "normandy-tools", "config.json")
+}
+
+// LoadConfig adds the environments in a config file to Environments.  A
+// missing file is not an error.
+func LoadConfig(path string) error {
+	if path == "" {
+		return nil
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "Failed reading config")
+	}
+
+	var config struct {
+		Environments map[string]*Environment `json:"environments"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return errors.Wrapf(err, "Failed decoding config %s", path)
+	}
+
+	for name, env := range config.Environments {
+		if env.BaseURL == "" {
+			return errors.Errorf("Environment %s in %s has no base_url", name, path)
+		}
+		if !strings.HasSuffix(env.BaseURL, "/") {
+			env.BaseURL += "/"
+		}
+		Environments[name] = env
+	}
+	return nil
+}
+
+// SetEnvironment selects the environment requests go to
+func SetEnvironment(name string) error {
+	env, ok := Environments[name]
+	if !ok {
+		return errors.Errorf("Unknown environment %q, use one of: %s", name, strings.Join(EnvironmentNames(), ", "))
+	}
+	currentEnvironment = env
+	return nil
+}
+
+// EnvironmentNames returns the names of the known environments, sorted
+func EnvironmentNames() []string {
+	names := make([]string, 0, len(Environments))
+	for name := range Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CurrentEnvironment returns the selected environment
+func CurrentEnvironment() *Environment {
+	return currentEnvironment
+}
+
+// APIURL returns the URL of path in the selected environment's API,
+// ie: APIURL("recipe/") is the recipe list
+func APIURL(path string) string {
+	return currentEnvironment.BaseURL + strings.TrimPrefix(path, "/")
+}
+
+// RecipeURL is the recipe list of the selected environment
+func RecipeURL() string {
+	return APIURL("recipe/")
+}
@@ -0,0 +1,171 @@
+package tools
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// setEnv sets an environment variable until the test ends, empty unsets it
+func setEnv(t *testing.T, key, value string) {
+	t.Helper()
+
+	old, ok := os.LookupEnv(key)
+	t.Cleanup(func() {
+		if ok {
+			os.Setenv(key, old)
+		} else {
+			os.Unsetenv(key)
+		}
+	})
+
+	if value == "" {
+		os.Unsetenv(key)
+	} else {
+		os.Setenv(key, value)
+	}
+}
+
+// keepEnvironments puts back the environments and the selected one when
+// the test ends
+func keepEnvironments(t *testing.T) {
+	environments := make(map[string]*Environment, len(Environments))
+	for name, env := range Environments {
+		environments[name] = env
+	}
+	current, name, config := currentEnvironment, envName, configFile
+
+	t.Cleanup(func() {
+		Environments = environments
+		currentEnvironment, envName, configFile = current, name, config
+	})
+}
+
+// writeConfig writes a config file that's removed when the test ends
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "normandy-tools-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestEnvFlag(t *testing.T) {
+	config := writeConfig(t, `{"environments": {"local": {"base_url": "http://localhost:9000/api/v3/"}}}`)
+
+	tests := []struct {
+		env  string // $NORMANDY_TOOLS_ENV
+		args []string
+		want string
+	}{
+		{"", nil, "prod"},
+		{"stage", nil, "stage"},
+		{"stage", []string{"-env", "dev"}, "dev"},
+		{"", []string{"-env", "prod-api"}, "prod-api"},
+		{"local", []string{"-config", config}, "local"},
+		{"", []string{"-config", config, "-env", "local"}, "local"},
+	}
+
+	for _, test := range tests {
+		keepEnvironments(t)
+		setEnv(t, EnvironmentEnv, test.env)
+
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		AddFlags(fs)
+		if err := fs.Parse(test.args); err != nil {
+			t.Fatal(err)
+		}
+		if err := LoadConfig(configFile); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := SetEnvironment(envName); err != nil {
+			t.Errorf("$%s=%q %v: %v", EnvironmentEnv, test.env, test.args, err)
+		} else if CurrentEnvironment() != Environments[test.want] {
+			t.Errorf("$%s=%q %v selected %s, want %s", EnvironmentEnv, test.env, test.args, envName, test.want)
+		}
+	}
+
+	// an unknown environment from the variable fails like -env does
+	keepEnvironments(t)
+	setEnv(t, EnvironmentEnv, "nope")
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	AddFlags(fs)
+	fs.Parse(nil)
+	if err := SetEnvironment(envName); err == nil {
+		t.Errorf("$%s=nope didn't fail", EnvironmentEnv)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	keepEnvironments(t)
+
+	path := writeConfig(t, `{"environments": {
+		"local": {"base_url": "http://localhost:9000/api/v3", "headers": {"Authorization": "Bearer x"}},
+		"dev": {"base_url": "http://localhost:8001/api/v3/"}
+	}}`)
+	if err := LoadConfig(path); err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Environment{BaseURL: "http://localhost:9000/api/v3/", Headers: map[string]string{"Authorization": "Bearer x"}}
+	if got := Environments["local"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("local = %+v, want %+v", got, want)
+	}
+	if got := Environments["dev"].BaseURL; got != "http://localhost:8001/api/v3/" {
+		t.Errorf("dev wasn't replaced, its base_url is %s", got)
+	}
+	if got := Environments["prod"].BaseURL; got != "https://normandy.cdn.mozilla.net/api/v3/" {
+		t.Errorf("prod changed to %s", got)
+	}
+	if got, want := EnvironmentNames(), []string{"dev", "local", "prod", "prod-api", "stage"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("EnvironmentNames = %v, want %v", got, want)
+	}
+
+	if err := SetEnvironment("local"); err != nil {
+		t.Fatal(err)
+	}
+	if got := APIURL("/recipe/"); got != "http://localhost:9000/api/v3/recipe/" {
+		t.Errorf(`APIURL("/recipe/") = %s`, got)
+	}
+
+	for _, path := range []string{"", filepath.Join(filepath.Dir(path), "missing.json")} {
+		if err := LoadConfig(path); err != nil {
+			t.Errorf("LoadConfig(%q) error: %v", path, err)
+		}
+	}
+
+	bad := []string{
+		`{"environments": `,
+		`{"environments": {"local": {"headers": {}}}}`,
+		`{"environments": {"local": {"base_url": 1}}}`,
+	}
+	for _, content := range bad {
+		if err := LoadConfig(writeConfig(t, content)); err == nil {
+			t.Errorf("LoadConfig of %s didn't fail", content)
+		}
+	}
+}
+
+func TestDefaultConfigFile(t *testing.T) {
+	setEnv(t, ConfigEnv, "/etc/normandy-tools.json")
+	if got := DefaultConfigFile(); got != "/etc/normandy-tools.json" {
+		t.Errorf("DefaultConfigFile = %s, want $%s", got, ConfigEnv)
+	}
+
+	setEnv(t, ConfigEnv, "")
+	if got := DefaultConfigFile(); got != "" && filepath.Base(got) != "config.json" {
+		t.Errorf("DefaultConfigFile = %s, want config.json in the user config dir", got)
+	}
+}
@@ -0,0 +1,329 @@
+package tools
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/pkg/errors"
+)
+
+// Filter is a decoded filter object.  Validate catches targeting Normandy
+// would reject or that can never match anyone.
+type Filter interface {
+	FilterType() string
+	Validate() error
+}
+
+type ChannelFilter struct {
+	Channels []string `json:"channels"`
+}
+
+type LocaleFilter struct {
+	Locales []string `json:"locales"`
+}
+
+type CountryFilter struct {
+	Countries []string `json:"countries"`
+}
+
+// VersionFilter matches every release of the major versions listed
+type VersionFilter struct {
+	Versions []int `json:"versions"`
+}
+
+// VersionRangeFilter matches MinVersion up to, but not including, MaxVersion
+type VersionRangeFilter struct {
+	MinVersion string `json:"min_version"`
+	MaxVersion string `json:"max_version"`
+}
+
+type PlatformFilter struct {
+	Platforms []string `json:"platforms"`
+}
+
+// BucketSampleFilter hashes Input into Total buckets and matches the Count
+// buckets from Start, wrapping around at Total
+type BucketSampleFilter struct {
+	Input []string `json:"input"`
+	Start float64  `json:"start"`
+	Count float64  `json:"count"`
+	Total float64  `json:"total"`
+}
+
+// StableSampleFilter matches Rate (0 to 1) of the clients by hashing Input
+type StableSampleFilter struct {
+	Input []string `json:"input"`
+	Rate  float64  `json:"rate"`
+}
+
+// NamespaceSampleFilter is a bucket sample of ["Namespace", normandy.userId]
+// over NamespaceBuckets buckets
+type NamespaceSampleFilter struct {
+	Namespace string  `json:"namespace"`
+	Start     float64 `json:"start"`
+	Count     float64 `json:"count"`
+}
+
+// NegateFilter matches the clients Filter doesn't
+type NegateFilter struct {
+	Filter FilterObject `json:"filter"`
+}
+
+// PresetFilter is a named set of filters defined by Normandy, the API uses
+// both "preset" and "presets" for its type
+type PresetFilter struct {
+	Type string `json:"type"`
+	Name string `json:"name"`
+}
+
+// ErrUnknownFilterType is returned by Decode for filter object types it
+// doesn't know.  Normandy may still accept them.
+var ErrUnknownFilterType = errors.New("Unknown filter object type")
+
+// NamespaceBuckets is the number of buckets a namespaceSample uses
+const NamespaceBuckets = 10000
+
+// MinVersion is the oldest Firefox version a version filter can target
+const MinVersion = 40
+
+var platforms = map[string]bool{"all_linux": true, "all_mac": true, "all_windows": true}
+
+func (f *ChannelFilter) FilterType() string         { return "channel" }
+func (f *LocaleFilter) FilterType() string          { return "locale" }
+func (f *CountryFilter) FilterType() string         { return "country" }
+func (f *VersionFilter) FilterType() string         { return "version" }
+func (f *VersionRangeFilter) FilterType() string    { return "versionRange" }
+func (f *PlatformFilter) FilterType() string        { return "platform" }
+func (f *BucketSampleFilter) FilterType() string    { return "bucketSample" }
+func (f *StableSampleFilter) FilterType() string    { return "stableSample" }
+func (f *NamespaceSampleFilter) FilterType() string { return "namespaceSample" }
+func (f *NegateFilter) FilterType() string          { return "negate" }
+
+func (f *PresetFilter) FilterType() string {
+	if f.Type == "" {
+		return "presets"
+	}
+	return f.Type
+}
+
+func (f *ChannelFilter) Validate() error {
+	return validateList("channels", f.Channels)
+}
+
+func (f *LocaleFilter) Validate() error {
+	return validateList("locales", f.Locales)
+}
+
+func (f *CountryFilter) Validate() error {
+	return validateList("countries", f.Countries)
+}
+
+func (f *VersionFilter) Validate() error {
+	if len(f.Versions) == 0 {
+		return errors.New("Empty versions list")
+	}
+	for _, v := range f.Versions {
+		if v < MinVersion {
+			return errors.Errorf("Version %d is older than %d", v, MinVersion)
+		}
+	}
+	return nil
+}
+
+func (f *VersionRangeFilter) Validate() error {
+	if f.MinVersion == "" || f.MaxVersion == "" {
+		return errors.New("Version range needs min_version and max_version")
+	}
+	if CompareVersions(f.MinVersion, f.MaxVersion) >= 0 {
+		return errors.Errorf("Inverted version range, %s is not before %s", f.MinVersion, f.MaxVersion)
+	}
+	return nil
+}
+
+func (f *PlatformFilter) Validate() error {
+	if err := validateList("platforms", f.Platforms); err != nil {
+		return err
+	}
+	for _, p := range f.Platforms {
+		if !platforms[p] {
+			return errors.Errorf("Unknown platform %q", p)
+		}
+	}
+	return nil
+}
+
+func (f *BucketSampleFilter) Validate() error {
+	if err := validateList("input", f.Input); err != nil {
+		return err
+	}
+	if f.Total <= 0 {
+		return errors.Errorf("Total %g is not positive", f.Total)
+	}
+	return validateSample(f.Start, f.Count, f.Total)
+}
+
+func (f *StableSampleFilter) Validate() error {
+	if err := validateList("input", f.Input); err != nil {
+		return err
+	}
+	if f.Rate < 0 || f.Rate > 1 {
+		return errors.Errorf("Rate %g is not between 0 and 1", f.Rate)
+	}
+	return nil
+}
+
+func (f *NamespaceSampleFilter) Validate() error {
+	if f.Namespace == "" {
+		return errors.New("Empty namespace")
+	}
+	return validateSample(f.Start, f.Count, NamespaceBuckets)
+}
+
+func (f *NegateFilter) Validate() error {
+	inner, err := f.Filter.Decode()
+	if err != nil {
+		return errors.Wrap(err, "Negated filter")
+	}
+	return errors.Wrap(inner.Validate(), "Negated filter")
+}
+
+func (f *PresetFilter) Validate() error {
+	if f.Name == "" {
+		return errors.New("Empty preset name")
+	}
+	return nil
+}
+
+func validateList(name string, values []string) error {
+	if len(values) == 0 {
+		return errors.Errorf("Empty %s list", name)
+	}
+	for _, v := range values {
+		if v == "" {
+			return errors.Errorf("Empty value in %s list", name)
+		}
+	}
+	return nil
+}
+
+func validateSample(start, count, total float64) error {
+	switch {
+	case start < 0 || start >= total:
+		return errors.Errorf("Sample start %g is not between 0 and %g", start, total)
+	case count < 0:
+		return errors.Errorf("Sample count %g is negative", count)
+	case count > total:
+		return errors.Errorf("Sample count %g is larger than total %g", count, total)
+	}
+	return nil
+}
+
+// Decode returns the typed filter for f.  Unknown types are
+// ErrUnknownFilterType.
+func (f FilterObject) Decode() (Filter, error) {
+	var filter Filter
+	switch f.Type {
+	case "channel":
+		filter = &ChannelFilter{}
+	case "locale":
+		filter = &LocaleFilter{}
+	case "country":
+		filter = &CountryFilter{}
+	case "version":
+		filter = &VersionFilter{}
+	case "versionRange":
+		filter = &VersionRangeFilter{}
+	case "platform":
+		filter = &PlatformFilter{}
+	case "bucketSample":
+		filter = &BucketSampleFilter{}
+	case "stableSample":
+		filter = &StableSampleFilter{}
+	case "namespaceSample":
+		filter = &NamespaceSampleFilter{}
+	case "negate":
+		filter = &NegateFilter{}
+	case "preset", "presets":
+		filter = &PresetFilter{}
+	default:
+		return nil, errors.Wrapf(ErrUnknownFilterType, "%q", f.Type)
+	}
+
+	if err := json.Unmarshal(f.Raw, filter); err != nil {
+		return nil, errors.Wrapf(err, "Failed decoding %s filter object", f.Type)
+	}
+	return filter, nil
+}
+
+// DecodeStrict is Decode that also fails on fields the filter's type doesn't
+// have, in negated filters too
+func (f FilterObject) DecodeStrict() (Filter, error) {
+	filter, err := f.Decode()
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(f.Raw, &fields); err != nil {
+		return nil, errors.Wrapf(err, "Failed decoding %s filter object", f.Type)
+	}
+	delete(fields, "type")
+	rest, err := json.Marshal(fields)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed decoding %s filter object", f.Type)
+	}
+
+	// a fresh value so only the fields are checked, f was decoded above
+	fresh := reflect.New(reflect.TypeOf(filter).Elem()).Interface()
+	if err := decodeStrict(rest, fresh); err != nil {
+		return nil, errors.Wrapf(err, "Failed decoding %s filter object", f.Type)
+	}
+
+	if negate, ok := filter.(*NegateFilter); ok {
+		if _, err := negate.Filter.DecodeStrict(); err != nil {
+			return nil, errors.Wrap(err, "Negated filter")
+		}
+	}
+	return filter, nil
+}
+
+// NewFilterObject encodes filter as a filter object
+func NewFilterObject(filter Filter) FilterObject {
+	fields := make(map[string]interface{})
+	if data, err := json.Marshal(filter); err == nil {
+		json.Unmarshal(data, &fields)
+	}
+
+	fields["type"] = filter.FilterType()
+	raw, _ := json.Marshal(fields)
+	return FilterObject{Type: filter.FilterType(), Raw: raw}
+}
+
+// Filters decodes and validates the revision's filter objects.  In strict
+// mode the first bad one is an error and unknown fields count as bad,
+// otherwise bad ones are left out and told to opts.OnError or logged.
+func (r *Revision) Filters(opts DecodeOptions) ([]Filter, error) {
+	filters := make([]Filter, 0, len(r.FilterObject))
+	for i, fo := range r.FilterObject {
+		decode := fo.Decode
+		if opts.Strict {
+			decode = fo.DecodeStrict
+		}
+
+		filter, err := decode()
+		if err == nil {
+			err = filter.Validate()
+		}
+
+		if err != nil {
+			err = errors.Wrapf(err, "Bad filter object %d of revision %d", i, r.ID)
+			if opts.Strict {
+				return nil, err
+			}
+			opts.skip(err)
+			continue
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
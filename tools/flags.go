@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	cacheType string
+	cacheDir  string
+
+	rateLimit   float64
+	rateBurst   int
+	maxInFlight int
+
+	envName    string
+	configFile string
+
+	since      string
+	until      string
+	windowDate string
+
+	columns string
+	sortBy  string
+
+	verbose bool
+	quiet   bool
+
+	storeDir     string
+	snapshotSpec string
+)
+
+var (
+	// Workers is how many pages or histories commands load at the same time
+	Workers = 8
+
+	// OutputFormat is the name of the Formatter commands print their
+	// reports with
+	OutputFormat = "table"
+
+	// OutputColumns and OutputSort are the columns to show and sort by, all
+	// of them in the command's order when empty
+	OutputColumns []string
+	OutputSort    []string
+)
+
+// AddFlags registers the flags shared by all the commands on fs
+func AddFlags(fs *flag.FlagSet) {
+	defaultEnv := os.Getenv(EnvironmentEnv)
+	if defaultEnv == "" {
+		defaultEnv = DefaultEnvironment
+	}
+
+	fs.StringVar(&envName, "env", defaultEnv, "Normandy environment: prod, prod-api, stage, dev or one from -config, $"+EnvironmentEnv+" changes the default")
+	fs.StringVar(&configFile, "config", DefaultConfigFile(), "config file with more environments")
+	fs.StringVar(&cacheType, "cache", "fs", "where to cache responses: fs, memory or none")
+	fs.StringVar(&cacheDir, "cache-dir", "", "directory for the fs cache (default $"+CacheDirEnv+" or the user cache dir)")
+	fs.BoolVar(&CacheRefresh, "refresh", CacheRefresh, "revalidate every cached response with the server")
+	fs.BoolVar(&CacheOffline, "offline", CacheOffline, "only use cached responses, never make requests")
+	fs.Float64Var(&rateLimit, "rate", RateLimit, "max requests per second to the server, 0 for no limit")
+	fs.IntVar(&rateBurst, "burst", RateBurst, "how many requests can go over -rate at once")
+	fs.IntVar(&maxInFlight, "max-in-flight", MaxInFlight, "max requests waiting for a response at the same time, 0 for no limit")
+	fs.DurationVar(&RequestTimeout, "timeout", RequestTimeout, "how long a single request can take, including reading the body, 0 for no limit")
+	fs.IntVar(&MaxRetries, "retries", MaxRetries, "how many times to retry 429s, 5xx responses, timeouts and dropped connections")
+	fs.DurationVar(&CacheMaxAge, "cache-max-age", CacheMaxAge, "how long a cached response is used before it is revalidated")
+	fs.IntVar(&Workers, "workers", Workers, "how many pages and recipe histories to load at the same time")
+	fs.StringVar(&OutputFormat, "format", OutputFormat, "output format: "+strings.Join(FormatterNames(), ", "))
+	fs.StringVar(&columns, "columns", "", "comma separated columns to show, ie: id,slug")
+	fs.StringVar(&sortBy, "sort", "", "comma separated columns to sort by, -column sorts descending, ie: -updated,id")
+	fs.StringVar(&storeDir, "store", "", "directory sync keeps snapshots in (default $"+StoreDirEnv+" or the user data dir)")
+	fs.StringVar(&snapshotSpec, "snapshot", "", "read recipes from a synced snapshot instead of the server: latest, a date like 2020-07-02 or a file")
+	fs.BoolVar(&verbose, "verbose", false, "log requests, pages and retries to stderr")
+	fs.BoolVar(&quiet, "quiet", false, "only log errors to stderr")
+	fs.StringVar(&since, "since", "", "only report on records from this time, ie: 2020-01-01 or 90d")
+	fs.StringVar(&until, "until", "", "only report on records before this time, ie: 2021-01-01 or 30d")
+	fs.StringVar(&windowDate, "window-date", TimeWindow.Date, "revision date -since and -until check: updated or created")
+}
+
+// ApplyFlags validates the shared flags after they are parsed and sets
+// up the tools package with them
+func ApplyFlags() error {
+	switch {
+	case verbose && quiet:
+		return errors.New("-verbose and -quiet can not be used together")
+	case verbose:
+		Log.SetLevel(LevelDebug)
+		Log.Time = true
+	case quiet:
+		Log.SetLevel(LevelError)
+	}
+
+	if err := LoadConfig(configFile); err != nil {
+		return err
+	}
+
+	if err := SetEnvironment(envName); err != nil {
+		return err
+	}
+
+	if Workers < 1 {
+		return errors.New("-workers has to be at least 1")
+	}
+
+	if _, ok := Formatters[OutputFormat]; !ok {
+		return errors.Errorf("Unknown -format %q, use one of: %s", OutputFormat, strings.Join(FormatterNames(), ", "))
+	}
+	OutputColumns = splitList(columns)
+	OutputSort = splitList(sortBy)
+
+	if MaxRetries < 0 {
+		return errors.New("-retries can not be negative")
+	}
+
+	if RequestTimeout < 0 {
+		return errors.New("-timeout can not be negative")
+	}
+
+	if CacheRefresh && CacheOffline {
+		return errors.New("-refresh and -offline can not be used together")
+	}
+
+	if rateLimit < 0 || rateBurst < 0 || maxInFlight < 0 {
+		return errors.New("-rate, -burst and -max-in-flight can not be negative")
+	}
+	SetLimits(rateLimit, rateBurst, maxInFlight)
+
+	c, err := OpenCache(cacheType, cacheDir)
+	if err != nil {
+		return err
+	}
+	SetCache(c)
+
+	TimeWindow, err = NewWindow(since, until, windowDate, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if snapshotSpec != "" {
+		info, err := CurrentStore().Find(snapshotSpec, time.Now())
+		if err != nil {
+			return err
+		}
+
+		s, err := LoadSnapshot(info.Path)
+		if err != nil {
+			return err
+		}
+		Log.Info("Reading snapshot", "path", s.Path, "created", s.Created.Format(time.RFC3339))
+		UseSnapshot(s)
+	}
+	return nil
+}
+
+// CurrentStore is the store for the selected environment, each environment
+// gets its own directory in -store
+func CurrentStore() *Store {
+	dir := storeDir
+	if dir == "" {
+		dir = DefaultStoreDir()
+	}
+	return &Store{Dir: filepath.Join(dir, envName)}
+}
+
+// splitList splits a comma separated flag value, skipping empty items
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -2,54 +2,158 @@ package tools
 
 import (
 	"bytes"
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
 	"net/http"
-	"os"
+	neturl "net/url"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-const (
-	cachedir = "/tmp/normandy-tools-cache/"
+// ErrNotCached is returned by Get in offline mode when the url isn't cached
+var ErrNotCached = errors.New("Not in cache")
+
+var (
+	// HTTPClient makes all the requests, replace it to change transports,
+	// proxies, etc
+	HTTPClient = &http.Client{}
+
+	// RequestTimeout limits how long a single request can take, including
+	// reading the body but not waiting for the rate limit.  Zero means no
+	// limit other than the context's.
+	RequestTimeout = 60 * time.Second
+
+	// CacheMaxAge is how long a cached response is used before it is
+	// revalidated with the server
+	CacheMaxAge = time.Hour
+
+	// CacheRefresh revalidates every cached response, no matter its age
+	CacheRefresh = false
+
+	// CacheOffline only uses the cache and never makes requests
+	CacheOffline = false
 )
 
-func init() {
+// Get is GetContext without a way to cancel it
+func Get(url string) ([]byte, error) {
+	return GetContext(context.Background(), url)
+}
 
-	// just make sure its there
-	if err := os.Mkdir(cachedir, 0755); err != nil && !os.IsExist(err) {
-		fmt.Println("MKDIR err: ", err.Error())
+// GetContext fetches url with HTTPClient.  Each attempt is aborted when ctx
+// is done or RequestTimeout runs out, whichever is first.  Transient failures
+// are retried, see MaxRetries.
+//
+// Responses are cached.  Cached responses older than CacheMaxAge are
+// revalidated with If-None-Match / If-Modified-Since and only downloaded
+// again if they changed.
+//
+// When a snapshot is in use, see UseSnapshot, it answers instead and the
+// network isn't used at all.
+func GetContext(ctx context.Context, url string) ([]byte, error) {
+	if s := CurrentSnapshot(); s != nil {
+		body, err := s.Get(url)
+		if err != nil {
+			recordFailure(url, 0, err)
+			return nil, err
+		}
+		Log.Debug("From snapshot", "url", url)
+		return body, nil
 	}
 
-}
+	// attempt to get from cache
+	cache := currentCache()
+	cached, ok := cache.Get(url)
+	if CacheOffline {
+		if !ok {
+			Log.Debug("Not cached", "url", url)
+			recordFailure(url, 0, ErrNotCached)
+			return nil, ErrNotCached
+		}
+		Log.Debug("Cached", "url", url)
+		return cached.Body, nil
+	}
 
-func cachefilename(url string) string {
-	h := md5.New()
-	io.WriteString(h, url)
-	return cachedir + hex.EncodeToString(h.Sum(nil))
+	if ok && !CacheRefresh && cached.fresh(time.Now()) {
+		Log.Debug("Cached", "url", url)
+		return cached.Body, nil
+	}
+
+	if ok {
+		Log.Debug("Revalidating", "url", url)
+	} else {
+		Log.Debug("Fetching", "url", url)
+	}
+
+	entry, attempts, err := retry(ctx, url, func() (*CacheEntry, error) {
+		return fetch(ctx, url, cached)
+	})
+
+	if err != nil {
+		Log.Debug("Fetch failed", "url", url, "attempts", attempts, "err", err)
+		recordFailure(url, attempts, err)
+		return nil, err
+	}
+
+	if err := cache.Set(url, entry); err != nil {
+		// whatever, good enough for the cli apps :D
+		Log.Warn("Unable to cache body", "url", url, "err", err)
+	}
+
+	return entry.Body, nil
 }
 
-func cacheget(url string) ([]byte, bool) {
-	data, err := ioutil.ReadFile(cachefilename(url))
-	return data, (err == nil)
+// StatusError is returned when the server responds with something other than
+// 200 (or 304 when revalidating)
+type StatusError struct {
+	Code       int
+	RetryAfter time.Duration
 }
 
-func cachewrite(url string, data []byte) error {
-	return ioutil.WriteFile(cachefilename(url), data, 0644)
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("Response Code is %d", e.Code)
 }
 
-func Cachedir() string { return cachedir }
-func Get(url string) ([]byte, error) {
+// fetch makes a single request for url, revalidating cached if it is not nil
+func fetch(ctx context.Context, url string, cached *CacheEntry) (*CacheEntry, error) {
+	// waiting for the limiter isn't part of the request, the timeout starts
+	// once it's our turn
+	release, err := currentLimiter().Acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	// attempt to get from cache
-	if body, ok := cacheget(url); ok {
-		return body, nil
+	if RequestTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, RequestTimeout)
+		defer cancel()
 	}
 
-	resp, err := http.Get(url)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// only send the environment's headers to its own server
+	env := CurrentEnvironment()
+	if base, err := neturl.Parse(env.BaseURL); err == nil && base.Host == req.URL.Host {
+		for k, v := range env.Headers {
+			req.Header.Set(k, v)
+		}
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	now := time.Now()
+	resp, err := HTTPClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
@@ -57,9 +161,19 @@ func Get(url string) ([]byte, error) {
 	if resp.Body == nil {
 		return nil, errors.New("Empty Body")
 	}
+	defer resp.Body.Close()
+
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		entry := *cached
+		entry.Fetched = now
+		return &entry, nil
+	}
 
 	if resp.StatusCode != 200 {
-		return nil, errors.Errorf("Response Code is %d", resp.StatusCode)
+		return nil, &StatusError{
+			Code:       resp.StatusCode,
+			RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), now),
+		}
 	}
 
 	var buf bytes.Buffer
@@ -67,12 +181,11 @@ func Get(url string) ([]byte, error) {
 		return nil, err
 	}
 
-	body := buf.Bytes()
-
-	if err := cachewrite(url, body); err != nil {
-		// whatever, good enough for the cli apps :D
-		fmt.Println("Unable to cache body", err.Error())
-	}
-
-	return body, nil
+	return &CacheEntry{
+		URL:          url,
+		Body:         buf.Bytes(),
+		Fetched:      now,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}, nil
 }
@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFetchTimeoutAfterLimiter(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("{}"))
+	}))
+	defer server.Close()
+
+	// one request at a time, the last one waits longer than the timeout
+	// for its turn but each request is quick enough
+	timeout := RequestTimeout
+	RequestTimeout = 250 * time.Millisecond
+	SetLimits(0, 0, 1)
+	defer func() {
+		RequestTimeout = timeout
+		SetLimits(0, 0, 0)
+	}()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = fetch(context.Background(), server.URL, nil)
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+
+	// the caller's context still stops the wait
+	release, err := currentLimiter().Acquire(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := fetch(ctx, server.URL, nil); err == nil {
+		t.Error("fetch didn't stop waiting when its context was done")
+	}
+}
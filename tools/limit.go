@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limiter keeps everything that goes through Get polite to the server, no
+// matter how many goroutines the commands use.  It combines a token bucket
+// (requests per second plus a burst) with a limit on requests in flight.
+type Limiter struct {
+	mu     sync.Mutex
+	rate   float64 // tokens per second, <= 0 means unlimited
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	inflight chan struct{} // nil means unlimited
+}
+
+// NewLimiter creates a Limiter allowing rate requests per second with bursts
+// of up to burst requests and at most maxInFlight requests at the same time.
+// A rate or maxInFlight <= 0 turns that limit off.
+func NewLimiter(rate float64, burst, maxInFlight int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+
+	l := &Limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+
+	if maxInFlight > 0 {
+		l.inflight = make(chan struct{}, maxInFlight)
+	}
+
+	return l
+}
+
+// Acquire waits for a free request slot and a rate limit token.  The
+// returned func must be called once the request is done.
+func (l *Limiter) Acquire(ctx context.Context) (func(), error) {
+	if l.inflight != nil {
+		select {
+		case l.inflight <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	release := func() {
+		if l.inflight != nil {
+			<-l.inflight
+		}
+	}
+
+	if err := l.wait(ctx); err != nil {
+		release()
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// wait takes a token from the bucket, sleeping until one is available
+func (l *Limiter) wait(ctx context.Context) error {
+	if l.rate <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+
+	// take the token now, even if it puts the bucket in debt, so
+	// waiters are served in the order they arrived
+	l.tokens--
+	delay := time.Duration(-l.tokens / l.rate * float64(time.Second))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// give the token back, it was never used
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+var (
+	// RateLimit is the requests per second allowed to the server,
+	// RateBurst how many can go at once and MaxInFlight how many can be
+	// waiting for a response.  Change them with SetLimits.
+	RateLimit   = 10.0
+	RateBurst   = 5
+	MaxInFlight = 4
+
+	limiterLock sync.Mutex
+	limiter     = NewLimiter(RateLimit, RateBurst, MaxInFlight)
+)
+
+// SetLimits replaces the Limiter shared by every request Get makes
+func SetLimits(rate float64, burst, maxInFlight int) {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+
+	RateLimit, RateBurst, MaxInFlight = rate, burst, maxInFlight
+	limiter = NewLimiter(rate, burst, maxInFlight)
+}
+
+func currentLimiter() *Limiter {
+	limiterLock.Lock()
+	defer limiterLock.Unlock()
+	return limiter
+}
@@ -0,0 +1,138 @@
+package tools
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how important a log message is
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	}
+	return "LEVEL(" + strconv.Itoa(int(l)) + ")"
+}
+
+// Logger writes diagnostics, one line per message:
+//
+//	WARN  Parse error recipe=401 err="unexpected token"
+//
+// The message is followed by key=value pairs so lines are easy to grep and
+// parse.  Messages below the logger's level are dropped.
+type Logger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level Level
+
+	// Time adds the time to every line
+	Time bool
+}
+
+// NewLogger returns a Logger writing messages at level and above to w
+func NewLogger(w io.Writer, level Level) *Logger {
+	return &Logger{w: w, level: level}
+}
+
+// Log is where the tools package and the commands send diagnostics.  It
+// writes to stderr so stdout is only the report.
+var Log = NewLogger(os.Stderr, LevelInfo)
+
+// SetLevel changes which messages are written
+func (l *Logger) SetLevel(level Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = level
+}
+
+// Enabled is true when messages at level are written
+func (l *Logger) Enabled(level Level) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return level >= l.level
+}
+
+// Debug is for following along: requests made, pages read, retries
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(LevelDebug, msg, keyvals)
+}
+
+// Info is for what someone running a command usually wants to know
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(LevelInfo, msg, keyvals)
+}
+
+// Warn is for data that was skipped or may be wrong, the report goes on
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(LevelWarn, msg, keyvals)
+}
+
+// Error is for failures that stop a command
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(LevelError, msg, keyvals)
+}
+
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+
+	var b strings.Builder
+	if l.Time {
+		b.WriteString(time.Now().Format("15:04:05.000 "))
+	}
+	fmt.Fprintf(&b, "%-5s %s", level, msg)
+
+	for i := 0; i < len(keyvals); i += 2 {
+		key := fmt.Sprint(keyvals[i])
+		var value interface{} = "(missing)"
+		if i+1 < len(keyvals) {
+			value = keyvals[i+1]
+		}
+		fmt.Fprintf(&b, " %s=%s", key, logValue(value))
+	}
+	b.WriteByte('\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// logValue renders a value, quoting it if it would be hard to tell apart
+// from the next key=value pair
+func logValue(v interface{}) string {
+	var s string
+	switch x := v.(type) {
+	case error:
+		s = x.Error()
+	case time.Duration:
+		s = x.String()
+	default:
+		s = Render(v)
+	}
+
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,375 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+)
+
+// Table is the records a command reports.  Values are strings, numbers,
+// bools or anything that encodes to JSON.
+type Table struct {
+	Columns []string
+	Rows    [][]interface{}
+}
+
+// NewTable returns an empty table with columns
+func NewTable(columns ...string) *Table {
+	return &Table{Columns: columns}
+}
+
+// Add appends a row, it has to have a value for every column
+func (t *Table) Add(values ...interface{}) {
+	if len(values) != len(t.Columns) {
+		panic(fmt.Sprintf("table row has %d values for %d columns", len(values), len(t.Columns)))
+	}
+	t.Rows = append(t.Rows, values)
+}
+
+func (t *Table) column(name string) (int, error) {
+	for i, c := range t.Columns {
+		if c == name {
+			return i, nil
+		}
+	}
+	return 0, errors.Errorf("Unknown column %q, use one of: %s", name, strings.Join(t.Columns, ", "))
+}
+
+// Select returns a table with only the named columns, in that order
+func (t *Table) Select(columns []string) (*Table, error) {
+	index := make([]int, len(columns))
+	for i, name := range columns {
+		var err error
+		if index[i], err = t.column(name); err != nil {
+			return nil, err
+		}
+	}
+
+	selected := &Table{Columns: columns, Rows: make([][]interface{}, len(t.Rows))}
+	for r, row := range t.Rows {
+		values := make([]interface{}, len(index))
+		for i, c := range index {
+			values[i] = row[c]
+		}
+		selected.Rows[r] = values
+	}
+	return selected, nil
+}
+
+// Sort orders the rows by the named columns, a column starting with - sorts
+// in descending order.  Numbers compare as numbers, everything else by how
+// it is rendered.
+func (t *Table) Sort(keys []string) error {
+	type sortKey struct {
+		index      int
+		descending bool
+	}
+
+	var by []sortKey
+	for _, key := range keys {
+		k := sortKey{}
+		if strings.HasPrefix(key, "-") {
+			k.descending = true
+			key = key[1:]
+		}
+
+		var err error
+		if k.index, err = t.column(key); err != nil {
+			return err
+		}
+		by = append(by, k)
+	}
+
+	sort.SliceStable(t.Rows, func(i, j int) bool {
+		for _, k := range by {
+			c := compareValues(t.Rows[i][k.index], t.Rows[j][k.index])
+			if c == 0 {
+				continue
+			}
+			if k.descending {
+				return c > 0
+			}
+			return c < 0
+		}
+		return false
+	})
+	return nil
+}
+
+func compareValues(a, b interface{}) int {
+	na, aok := number(a)
+	nb, bok := number(b)
+	if aok && bok {
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(Render(a), Render(b))
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// Render is how text formats show a value: nil is empty and anything that
+// isn't a string, number or bool is compact JSON
+func Render(v interface{}) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case int:
+		return strconv.Itoa(x)
+	case int64:
+		return strconv.FormatInt(x, 10)
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(x)
+	case fmt.Stringer:
+		return x.String()
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
+
+// Formatter writes a table in some format
+type Formatter interface {
+	Format(w io.Writer, t *Table) error
+}
+
+// FormatterFunc makes a function a Formatter
+type FormatterFunc func(w io.Writer, t *Table) error
+
+func (f FormatterFunc) Format(w io.Writer, t *Table) error {
+	return f(w, t)
+}
+
+// Formatters are the formats -format can pick, add to it for more
+var Formatters = map[string]Formatter{
+	"table":    FormatterFunc(formatTable),
+	"json":     FormatterFunc(formatJSON),
+	"jsonl":    FormatterFunc(formatJSONL),
+	"csv":      FormatterFunc(formatCSV),
+	"tsv":      FormatterFunc(formatTSV),
+	"markdown": FormatterFunc(formatMarkdown),
+}
+
+// FormatterNames returns the names of the known formats, sorted
+func FormatterNames() []string {
+	names := make([]string, 0, len(Formatters))
+	for name := range Formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Output writes t to stdout with the -columns, -sort and -format flags
+func Output(t *Table) error {
+	return Write(os.Stdout, t, OutputFormat, OutputColumns, OutputSort)
+}
+
+// Write sorts t by sortKeys, keeps only columns (all of them when empty)
+// and writes it to w in format
+func Write(w io.Writer, t *Table, format string, columns, sortKeys []string) error {
+	f, ok := Formatters[format]
+	if !ok {
+		return errors.Errorf("Unknown format %q, use one of: %s", format, strings.Join(FormatterNames(), ", "))
+	}
+
+	// sort first so rows can be sorted by columns that aren't shown
+	if len(sortKeys) > 0 {
+		if err := t.Sort(sortKeys); err != nil {
+			return err
+		}
+	}
+
+	if len(columns) > 0 {
+		var err error
+		if t, err = t.Select(columns); err != nil {
+			return err
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := f.Format(bw, t); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// formatTable lines the columns up for people to read
+func formatTable(w io.Writer, t *Table) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+
+	dashes := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		dashes[i] = strings.Repeat("-", len(c))
+	}
+	fmt.Fprintln(tw, strings.Join(t.Columns, "\t"))
+	fmt.Fprintln(tw, strings.Join(dashes, "\t"))
+
+	for _, row := range t.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			// tabs and newlines would break the columns
+			values[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(Render(v))
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// jsonObject encodes a row as an object with the keys in column order
+func jsonObject(columns []string, row []interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		key, _ := json.Marshal(c)
+		value, err := json.Marshal(row[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "Failed encoding column %s", c)
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// formatJSON writes an array of objects
+func formatJSON(w io.Writer, t *Table) error {
+	rows := make([]json.RawMessage, len(t.Rows))
+	for i, row := range t.Rows {
+		obj, err := jsonObject(t.Columns, row)
+		if err != nil {
+			return err
+		}
+		rows[i] = obj
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(rows)
+}
+
+// formatJSONL writes an object per line
+func formatJSONL(w io.Writer, t *Table) error {
+	for _, row := range t.Rows {
+		obj, err := jsonObject(t.Columns, row)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatCSV(w io.Writer, t *Table) error {
+	cw := csv.NewWriter(w)
+	cw.Write(t.Columns)
+	for _, row := range t.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = Render(v)
+		}
+		cw.Write(values)
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// formatTSV escapes tabs, newlines and backslashes in values instead of
+// quoting them like CSV does
+func formatTSV(w io.Writer, t *Table) error {
+	escape := strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`)
+	line := func(values []string) error {
+		for i := range values {
+			values[i] = escape.Replace(values[i])
+		}
+		_, err := fmt.Fprintln(w, strings.Join(values, "\t"))
+		return err
+	}
+
+	if err := line(append([]string(nil), t.Columns...)); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = Render(v)
+		}
+		if err := line(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatMarkdown(w io.Writer, t *Table) error {
+	escape := strings.NewReplacer("|", `\|`, "\n", "<br>")
+	line := func(values []string) error {
+		for i := range values {
+			values[i] = escape.Replace(values[i])
+		}
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(values, " | "))
+		return err
+	}
+
+	dashes := make([]string, len(t.Columns))
+	for i := range dashes {
+		dashes[i] = "---"
+	}
+
+	if err := line(append([]string(nil), t.Columns...)); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "|%s|\n", strings.Join(dashes, "|")); err != nil {
+		return err
+	}
+	for _, row := range t.Rows {
+		values := make([]string, len(row))
+		for i, v := range row {
+			values[i] = Render(v)
+		}
+		if err := line(values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package tools
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func testTable() *Table {
+	t := NewTable("id", "slug", "days")
+	t.Add(3, "b", 10)
+	t.Add(1, "c", 2.5)
+	t.Add(20, "a", 10)
+	t.Add(2, "b", nil)
+	return t
+}
+
+func column(t *Table, name string) []interface{} {
+	i, _ := t.column(name)
+	values := make([]interface{}, len(t.Rows))
+	for r, row := range t.Rows {
+		values[r] = row[i]
+	}
+	return values
+}
+
+func TestTableSort(t *testing.T) {
+	tests := []struct {
+		keys []string
+		want []interface{} // the ids
+	}{
+		// numbers compare as numbers, not 20 < 3
+		{[]string{"id"}, []interface{}{1, 2, 3, 20}},
+		{[]string{"-id"}, []interface{}{20, 3, 2, 1}},
+		{[]string{"slug"}, []interface{}{20, 3, 2, 1}},
+		{[]string{"slug", "-id"}, []interface{}{20, 3, 2, 1}},
+		{[]string{"slug", "id"}, []interface{}{20, 2, 3, 1}},
+
+		// mixed ints and floats are numbers too, nil renders empty and sorts
+		// first
+		{[]string{"days", "id"}, []interface{}{2, 1, 3, 20}},
+		{[]string{"-days", "-id"}, []interface{}{20, 3, 1, 2}},
+
+		// equal rows keep their order
+		{[]string{"-days"}, []interface{}{3, 20, 1, 2}},
+		{nil, []interface{}{3, 1, 20, 2}},
+	}
+
+	for _, test := range tests {
+		table := testTable()
+		if err := table.Sort(test.keys); err != nil {
+			t.Errorf("Sort(%v) error: %v", test.keys, err)
+			continue
+		}
+		if got := column(table, "id"); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Sort(%v) = %v, want %v", test.keys, got, test.want)
+		}
+	}
+
+	for _, keys := range [][]string{{"name"}, {"id", "-"}, {"--id"}} {
+		if err := testTable().Sort(keys); err == nil {
+			t.Errorf("Sort(%v) didn't fail", keys)
+		}
+	}
+}
+
+func TestTableSelect(t *testing.T) {
+	table, err := testTable().Select([]string{"slug", "id"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Table{
+		Columns: []string{"slug", "id"},
+		Rows:    [][]interface{}{{"b", 3}, {"c", 1}, {"a", 20}, {"b", 2}},
+	}
+	if !reflect.DeepEqual(table, want) {
+		t.Errorf("Select = %+v, want %+v", table, want)
+	}
+
+	if _, err := testTable().Select([]string{"id", "name"}); err == nil {
+		t.Error("Select of an unknown column didn't fail")
+	}
+}
+
+func TestWrite(t *testing.T) {
+	table := NewTable("id", "value")
+	table.Add(2, "plain")
+	table.Add(1, "a,b \"quoted\"\nnext\tline|pipe \\ back\rreturn")
+
+	tests := []struct {
+		format  string
+		columns []string
+		sort    []string
+		want    string
+	}{
+		{
+			format: "csv",
+			want:   "id,value\n2,plain\n1,\"a,b \"\"quoted\"\"\nnext\tline|pipe \\ back\rreturn\"\n",
+		},
+		{
+			format: "tsv",
+			want:   "id\tvalue\n2\tplain\n1\ta,b \"quoted\"\\nnext\\tline|pipe \\\\ back\\rreturn\n",
+		},
+		{
+			format: "markdown",
+			want: "| id | value |\n|---|---|\n| 2 | plain |\n" +
+				"| 1 | a,b \"quoted\"<br>next\tline\\|pipe \\ back\rreturn |\n",
+		},
+		{
+			format: "jsonl",
+			want: `{"id":2,"value":"plain"}` + "\n" +
+				`{"id":1,"value":"a,b \"quoted\"\nnext\tline|pipe \\ back\rreturn"}` + "\n",
+		},
+		{
+			// sorted by a column that isn't shown
+			format:  "csv",
+			columns: []string{"value"},
+			sort:    []string{"id"},
+			want:    "value\n\"a,b \"\"quoted\"\"\nnext\tline|pipe \\ back\rreturn\"\nplain\n",
+		},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		if err := Write(&buf, testCopy(table), test.format, test.columns, test.sort); err != nil {
+			t.Errorf("%s: %v", test.format, err)
+			continue
+		}
+		if got := buf.String(); got != test.want {
+			t.Errorf("%s:\n%q\nwant\n%q", test.format, got, test.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, table, "xml", nil, nil); err == nil {
+		t.Error("Write in an unknown format didn't fail")
+	}
+	if err := Write(&buf, table, "csv", []string{"name"}, nil); err == nil {
+		t.Error("Write of an unknown column didn't fail")
+	}
+}
+
+// testCopy copies t so sorting it doesn't change the original
+func testCopy(t *Table) *Table {
+	c := &Table{Columns: t.Columns}
+	for _, row := range t.Rows {
+		c.Rows = append(c.Rows, append([]interface{}(nil), row...))
+	}
+	return c
+}
+
+func TestWriteTable(t *testing.T) {
+	table := NewTable("id", "slug")
+	table.Add(1, "two\twords")
+	table.Add(100, "two\nlines")
+
+	var buf bytes.Buffer
+	if err := Write(&buf, table, "table", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "id   slug\n" +
+		"--   ----\n" +
+		"1    two words\n" +
+		"100  two lines\n"
+	if got := buf.String(); got != want {
+		t.Errorf("table:\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, ""},
+		{"s", "s"},
+		{42, "42"},
+		{int64(-7), "-7"},
+		{2.50, "2.5"},
+		{1e21, "1000000000000000000000"},
+		{true, "true"},
+		{time.Second, "1s"},
+		{[]string{"a", "b"}, `["a","b"]`},
+		{map[string]int{"a": 1}, `{"a":1}`},
+	}
+
+	for _, test := range tests {
+		if got := Render(test.v); got != test.want {
+			t.Errorf("Render(%#v) = %q, want %q", test.v, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package tools
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// ErrPoolClosed is returned by Submit after Wait was called
+var ErrPoolClosed = errors.New("Pool is closed")
+
+// Task is a unit of work for a Pool, usually a fetch and process of one url
+type Task func(ctx context.Context) (interface{}, error)
+
+// Result is what a Task returned
+type Result struct {
+	Index int    // order the task was submitted in
+	Name  string // name given to Submit, ie: the url, for error messages
+	Value interface{}
+	Err   error
+}
+
+// Pool runs tasks with a fixed number of workers.  Tasks are submitted
+// with Submit, which blocks while all the workers are busy.  Wait closes
+// the pool, waits for every submitted task to finish and returns all the
+// results.  Once ctx is done the remaining tasks are not run, their results
+// have ctx's error.
+//
+// Submit can be called from many goroutines but not at the same time as Wait.
+type Pool struct {
+	ctx  context.Context
+	todo chan poolTask
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	next    int
+	closed  bool
+	results []Result
+}
+
+type poolTask struct {
+	index int
+	name  string
+	task  Task
+}
+
+func NewPool(ctx context.Context, workers int) *Pool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &Pool{
+		ctx:  ctx,
+		todo: make(chan poolTask),
+	}
+
+	for n := 0; n < workers; n++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+
+	return p
+}
+
+func (p *Pool) work() {
+	defer p.wg.Done()
+
+	for t := range p.todo {
+		var value interface{}
+		err := p.ctx.Err()
+		if err == nil {
+			value, err = t.task(p.ctx)
+		}
+
+		p.mu.Lock()
+		p.results = append(p.results, Result{t.index, t.name, value, err})
+		p.mu.Unlock()
+	}
+}
+
+// Submit hands task to the next free worker.  It returns an error without
+// running task if the pool is closed or ctx is done.  A task that isn't run
+// because ctx is done still has a result with ctx's error, one submitted
+// after Wait has none.
+func (p *Pool) Submit(name string, task Task) error {
+	p.mu.Lock()
+	if p.closed {
+		p.mu.Unlock()
+		return ErrPoolClosed
+	}
+	index := p.next
+	p.next++
+	p.mu.Unlock()
+
+	select {
+	case p.todo <- poolTask{index, name, task}:
+		return nil
+	case <-p.ctx.Done():
+		// the task still gets a result so Wait has one for every index
+		err := p.ctx.Err()
+		p.mu.Lock()
+		p.results = append(p.results, Result{index, name, nil, err})
+		p.mu.Unlock()
+		return err
+	}
+}
+
+// Wait closes the pool and returns the results of every task that was
+// submitted, in the order they were submitted
+func (p *Pool) Wait() []Result {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.todo)
+	}
+	p.mu.Unlock()
+
+	p.wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	results := append([]Result(nil), p.results...)
+	sort.Slice(results, func(i, j int) bool { return results[i].Index < results[j].Index })
+	return results
+}
@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPoolOrderedResults(t *testing.T) {
+	pool := NewPool(context.Background(), 4)
+
+	const n = 20
+	for i := 0; i < n; i++ {
+		i := i
+		err := pool.Submit(fmt.Sprint(i), func(ctx context.Context) (interface{}, error) {
+			// later tasks finish first
+			time.Sleep(time.Duration(n-i) * time.Millisecond)
+			return i, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	results := pool.Wait()
+	if len(results) != n {
+		t.Fatalf("got %d results, want %d", len(results), n)
+	}
+	for i, r := range results {
+		if r.Index != i || r.Value != i || r.Name != fmt.Sprint(i) || r.Err != nil {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+}
+
+func TestPoolCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewPool(ctx, 1)
+
+	var ran int32
+	started := make(chan bool)
+	pool.Submit("blocked", func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&ran, 1)
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	<-started
+	cancel()
+
+	// the only worker is busy so this can only go through once it's done,
+	// and then ctx is too
+	if err := pool.Submit("after cancel", func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&ran, 1)
+		return nil, nil
+	}); err != nil && err != context.Canceled {
+		t.Errorf("Submit after cancel = %v, want nil or context.Canceled", err)
+	}
+
+	results := pool.Wait()
+	if ran != 1 {
+		t.Errorf("%d tasks ran, want 1", ran)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i {
+			t.Errorf("result %d has index %d", i, r.Index)
+		}
+		if r.Err != context.Canceled {
+			t.Errorf("result %s err = %v, want context.Canceled", r.Name, r.Err)
+		}
+	}
+}
+
+func TestPoolSubmitAfterCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	pool := NewPool(ctx, 2)
+	cancel()
+
+	// whether Submit gives up or a worker takes the task, it isn't run
+	for _, name := range []string{"a", "b", "c"} {
+		pool.Submit(name, func(ctx context.Context) (interface{}, error) { return name, nil })
+	}
+
+	results := pool.Wait()
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+	for i, r := range results {
+		if r.Index != i || r.Name != []string{"a", "b", "c"}[i] || r.Value != nil || r.Err != context.Canceled {
+			t.Errorf("result %d = %+v", i, r)
+		}
+	}
+}
+
+func TestPoolSubmitAfterWait(t *testing.T) {
+	pool := NewPool(context.Background(), 2)
+	pool.Submit("first", func(ctx context.Context) (interface{}, error) { return 1, nil })
+
+	if results := pool.Wait(); len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+
+	err := pool.Submit("late", func(ctx context.Context) (interface{}, error) { return 2, nil })
+	if err != ErrPoolClosed {
+		t.Errorf("Submit after Wait = %v, want ErrPoolClosed", err)
+	}
+
+	// Wait again is fine and has the same results
+	if results := pool.Wait(); len(results) != 1 {
+		t.Errorf("second Wait got %d results, want 1", len(results))
+	}
+}
@@ -0,0 +1,77 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+)
+
+// PreferenceSetting is a value a recipe sets a preference to.  Experiments
+// have one per branch, rollouts have no branch.
+type PreferenceSetting struct {
+	Pref       string
+	Branch     string
+	BranchType string // "default" or "user"
+	Type       string // "boolean", "integer" or "string", when the recipe says
+	Value      string // compact JSON
+}
+
+// PreferenceSettings returns the preferences set by a preference-experiment,
+// multi-preference-experiment or preference-rollout revision, sorted by
+// preference and branch.  Other actions don't set any.
+func (r *Revision) PreferenceSettings() []PreferenceSetting {
+	args := r.Arguments
+	var settings []PreferenceSetting
+
+	switch r.Action.Name {
+	case "preference-experiment":
+		for _, b := range args.Branches {
+			settings = append(settings, PreferenceSetting{
+				Pref:       args.PreferenceName,
+				Branch:     b.Slug,
+				BranchType: args.PreferenceBranchType,
+				Type:       args.PreferenceType,
+				Value:      compactJSON(b.Value),
+			})
+		}
+
+	case "multi-preference-experiment":
+		for _, b := range args.Branches {
+			for name, p := range b.Preferences {
+				settings = append(settings, PreferenceSetting{
+					Pref:       name,
+					Branch:     b.Slug,
+					BranchType: p.PreferenceBranchType,
+					Type:       p.PreferenceType,
+					Value:      compactJSON(p.PreferenceValue),
+				})
+			}
+		}
+
+	case "preference-rollout":
+		// rollouts always change the default branch
+		for _, p := range args.Preferences {
+			settings = append(settings, PreferenceSetting{
+				Pref:       p.PreferenceName,
+				BranchType: "default",
+				Value:      compactJSON(p.Value),
+			})
+		}
+	}
+
+	sort.SliceStable(settings, func(i, j int) bool {
+		if settings[i].Pref != settings[j].Pref {
+			return settings[i].Pref < settings[j].Pref
+		}
+		return settings[i].Branch < settings[j].Branch
+	})
+	return settings
+}
+
+func compactJSON(data json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return string(data)
+	}
+	return buf.String()
+}
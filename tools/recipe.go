@@ -0,0 +1,325 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/pkg/errors"
+)
+
+// Types for the Normandy v3 API.  Only the fields the tools care about are
+// typed, the rest are kept as json.RawMessage so strict decoding still knows
+// about them.
+
+// RecipePage is one page of results from /api/v3/recipe/
+type RecipePage struct {
+	Count    int      `json:"count"`
+	Next     string   `json:"next"`
+	Previous string   `json:"previous"`
+	Results  []Recipe `json:"results"`
+}
+
+type Recipe struct {
+	ID               int             `json:"id"`
+	LatestRevision   *Revision       `json:"latest_revision"`
+	ApprovedRevision *Revision       `json:"approved_revision"`
+	Signature        json.RawMessage `json:"signature"`
+}
+
+// RecipeRef is the short version of a recipe embedded in a revision
+type RecipeRef struct {
+	ID         int  `json:"id"`
+	IsApproved bool `json:"is_approved"`
+}
+
+type Revision struct {
+	ID                    int            `json:"id"`
+	DateCreated           string         `json:"date_created"`
+	Updated               string         `json:"updated"`
+	Enabled               bool           `json:"enabled"`
+	Name                  string         `json:"name"`
+	Comment               string         `json:"comment"`
+	Action                Action         `json:"action"`
+	Arguments             Arguments      `json:"arguments"`
+	FilterExpression      string         `json:"filter_expression"`
+	ExtraFilterExpression string         `json:"extra_filter_expression"`
+	FilterObject          []FilterObject `json:"filter_object"`
+	Capabilities          []string       `json:"capabilities"`
+	ExtraCapabilities     []string       `json:"extra_capabilities"`
+	BugNumber             int            `json:"bug_number"`
+	ExperimenterSlug      string         `json:"experimenter_slug"`
+	IdenticonSeed         string         `json:"identicon_seed"`
+	Recipe                RecipeRef      `json:"recipe"`
+
+	ApprovalRequest json.RawMessage `json:"approval_request"`
+	Creator         json.RawMessage `json:"creator"`
+	EnabledStates   []EnabledState  `json:"enabled_states"`
+	Metadata        json.RawMessage `json:"metadata"`
+}
+
+// EnabledState is a revision being enabled or disabled.  Revisions approved
+// while the recipe is enabled start with one carried over from the previous
+// revision.
+type EnabledState struct {
+	ID            int             `json:"id"`
+	RevisionID    int             `json:"revision_id"`
+	Created       string          `json:"created"`
+	Enabled       bool            `json:"enabled"`
+	CarryoverFrom *int            `json:"carryover_from"`
+	Creator       json.RawMessage `json:"creator"`
+}
+
+type Action struct {
+	ID                int             `json:"id"`
+	Name              string          `json:"name"`
+	ImplementationURL string          `json:"implementation_url"`
+	ArgumentsSchema   json.RawMessage `json:"arguments_schema"`
+}
+
+// Arguments is the union of the arguments used by Normandy's actions.  Each
+// action only fills in the fields it uses, Raw always has the original JSON.
+type Arguments struct {
+	// shared by most study/experiment actions
+	Slug                  string   `json:"slug"`
+	UserFacingName        string   `json:"userFacingName"`
+	UserFacingDescription string   `json:"userFacingDescription"`
+	IsEnrollmentPaused    bool     `json:"isEnrollmentPaused"`
+	IsHighPopulation      bool     `json:"isHighPopulation"`
+	ExperimentDocumentURL string   `json:"experimentDocumentUrl"`
+	Branches              []Branch `json:"branches"`
+
+	// preference-experiment
+	PreferenceName       string `json:"preferenceName"`
+	PreferenceType       string `json:"preferenceType"`
+	PreferenceBranchType string `json:"preferenceBranchType"`
+
+	// preference-rollout
+	Preferences []RolloutPreference `json:"preferences"`
+
+	// opt-out-study
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	AddonURL       string `json:"addonUrl"`
+	ExtensionApiID int    `json:"extensionApiId"`
+
+	// show-heartbeat, console-log
+	SurveyID string `json:"surveyId"`
+	Message  string `json:"message"`
+
+	Raw json.RawMessage `json:"-"`
+}
+
+func (a *Arguments) UnmarshalJSON(data []byte) error {
+	// alias so json doesn't recurse back into this method
+	type arguments Arguments
+	var args arguments
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+
+	*a = Arguments(args)
+	a.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+// Branch is a branch of preference-experiment, multi-preference-experiment
+// or branched-addon-study
+type Branch struct {
+	Slug           string                      `json:"slug"`
+	Ratio          int                         `json:"ratio"`
+	Value          json.RawMessage             `json:"value"`
+	Preferences    map[string]BranchPreference `json:"preferences"`
+	ExtensionApiID int                         `json:"extensionApiId"`
+}
+
+// BranchPreference is a preference set by a multi-preference-experiment branch
+type BranchPreference struct {
+	PreferenceBranchType string          `json:"preferenceBranchType"`
+	PreferenceType       string          `json:"preferenceType"`
+	PreferenceValue      json.RawMessage `json:"preferenceValue"`
+}
+
+// RolloutPreference is a preference set by a preference-rollout
+type RolloutPreference struct {
+	PreferenceName string          `json:"preferenceName"`
+	Value          json.RawMessage `json:"value"`
+}
+
+// FilterObject is a single entry in a revision's filter_object list
+type FilterObject struct {
+	Type string
+	Raw  json.RawMessage
+}
+
+func (f *FilterObject) UnmarshalJSON(data []byte) error {
+	var fo struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &fo); err != nil {
+		return err
+	}
+
+	f.Type = fo.Type
+	f.Raw = append(json.RawMessage(nil), data...)
+	return nil
+}
+
+func (f FilterObject) MarshalJSON() ([]byte, error) {
+	if len(f.Raw) == 0 {
+		return json.Marshal(struct {
+			Type string `json:"type"`
+		}{f.Type})
+	}
+	return f.Raw, nil
+}
+
+// DecodeOptions controls how API payloads are decoded
+type DecodeOptions struct {
+	// Strict fails on fields the types above don't know about, including
+	// in arguments and filter objects, and on any record that doesn't
+	// decode.  Filter objects of types FilterObject.Decode doesn't know are
+	// errors too.  When false unknown fields are ignored and bad records are
+	// skipped.
+	Strict bool
+
+	// OnError, if set, is told about records skipped in lenient mode instead
+	// of them being logged as warnings
+	OnError func(err error)
+}
+
+var (
+	Lenient = DecodeOptions{}
+	Strict  = DecodeOptions{Strict: true}
+)
+
+func (o DecodeOptions) decode(data []byte, v interface{}) error {
+	if !o.Strict {
+		return json.Unmarshal(data, v)
+	}
+
+	if err := decodeStrict(data, v); err != nil {
+		return err
+	}
+
+	// DisallowUnknownFields doesn't reach the UnmarshalJSON methods of
+	// Arguments and FilterObject so they are checked again
+	switch v := v.(type) {
+	case *Recipe:
+		for _, rev := range []*Revision{v.LatestRevision, v.ApprovedRevision} {
+			if rev == nil {
+				continue
+			}
+			if err := rev.checkFields(); err != nil {
+				return errors.Wrapf(err, "revision %d", rev.ID)
+			}
+		}
+	case *Revision:
+		return v.checkFields()
+	}
+	return nil
+}
+
+func (o DecodeOptions) skip(err error) {
+	if o.OnError != nil {
+		o.OnError(err)
+		return
+	}
+	Log.Warn("Skipped record", "err", err)
+}
+
+// decodeStrict decodes data into v failing on fields v doesn't have
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// checkFields fails on arguments or filter objects with fields the types
+// don't know about
+func (r *Revision) checkFields() error {
+	if len(r.Arguments.Raw) > 0 {
+		// alias so json doesn't call Arguments.UnmarshalJSON
+		type arguments Arguments
+		if err := decodeStrict(r.Arguments.Raw, &arguments{}); err != nil {
+			return errors.Wrap(err, "arguments")
+		}
+	}
+
+	for i, fo := range r.FilterObject {
+		if _, err := fo.DecodeStrict(); err != nil {
+			return errors.Wrapf(err, "filter_object %d", i)
+		}
+	}
+	return nil
+}
+
+// DecodeRecipe decodes a single recipe, ie: one of the results in a
+// /recipe/ page
+func DecodeRecipe(data []byte, opts DecodeOptions) (*Recipe, error) {
+	var recipe Recipe
+	if err := opts.decode(data, &recipe); err != nil {
+		return nil, errors.Wrap(err, "Failed decoding recipe")
+	}
+	return &recipe, nil
+}
+
+// DecodeRecipePage decodes the /recipe/ list payload
+func DecodeRecipePage(data []byte, opts DecodeOptions) (*RecipePage, error) {
+	var page struct {
+		Count    int               `json:"count"`
+		Next     string            `json:"next"`
+		Previous string            `json:"previous"`
+		Results  []json.RawMessage `json:"results"`
+	}
+
+	if err := opts.decode(data, &page); err != nil {
+		return nil, errors.Wrap(err, "Failed decoding recipe page")
+	}
+
+	result := &RecipePage{
+		Count:    page.Count,
+		Next:     page.Next,
+		Previous: page.Previous,
+		Results:  make([]Recipe, 0, len(page.Results)),
+	}
+
+	for i, raw := range page.Results {
+		recipe, err := DecodeRecipe(raw, opts)
+		if err != nil {
+			err = errors.Wrapf(err, "result %d", i)
+			if opts.Strict {
+				return nil, err
+			}
+			opts.skip(err)
+			continue
+		}
+		result.Results = append(result.Results, *recipe)
+	}
+
+	return result, nil
+}
+
+// DecodeHistory decodes the /recipe/{id}/history/ payload.  Revisions are
+// returned in the same order as the API sent them.
+func DecodeHistory(data []byte, opts DecodeOptions) ([]Revision, error) {
+	var raws []json.RawMessage
+	if err := json.Unmarshal(data, &raws); err != nil {
+		return nil, errors.Wrap(err, "Failed decoding history")
+	}
+
+	revisions := make([]Revision, 0, len(raws))
+	for i, raw := range raws {
+		var revision Revision
+		if err := opts.decode(raw, &revision); err != nil {
+			err = errors.Wrapf(err, "Failed decoding revision %d", i)
+			if opts.Strict {
+				return nil, err
+			}
+			opts.skip(err)
+			continue
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
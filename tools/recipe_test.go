@@ -0,0 +1,87 @@
+package tools
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const revisionJSON = `{
+	"id": 1,
+	"date_created": "2020-01-02T03:04:05.000000Z",
+	"enabled": true,
+	"action": {"id": 1, "name": "preference-experiment"},
+	"arguments": {"slug": "a-slug"%s},
+	"filter_object": [%s]
+}`
+
+func revision(args, filters string) []byte {
+	return []byte(strings.Replace(strings.Replace(revisionJSON, "%s", args, 1), "%s", filters, 1))
+}
+
+func TestDecodeStrictNested(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr bool
+	}{
+		{"known fields", revision("", `{"type": "channel", "channels": ["release"]}`), false},
+		{"unknown argument", revision(`, "bogusField": 1`, ""), true},
+		{"unknown branch field", revision(`, "branches": [{"slug": "a", "bogus": 1}]`, ""), true},
+		{"unknown filter field", revision("", `{"type": "channel", "channels": ["release"], "bogus": 1}`), true},
+		{"unknown negated filter field", revision("", `{"type": "negate", "filter": {"type": "country", "countries": ["CA"], "bogus": 1}}`), true},
+		{"unknown filter type", revision("", `{"type": "bogus"}`), true},
+		{"preset type", revision("", `{"type": "preset", "name": "pocket-1"}`), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := DecodeHistory([]byte("["+string(test.data)+"]"), Strict)
+			if (err != nil) != test.wantErr {
+				t.Errorf("DecodeHistory strict err = %v, want error %v", err, test.wantErr)
+			}
+
+			revisions, err := DecodeHistory([]byte("["+string(test.data)+"]"), Lenient)
+			if err != nil || len(revisions) != 1 {
+				t.Errorf("DecodeHistory lenient = %d revisions, %v, want 1 revision", len(revisions), err)
+			}
+		})
+	}
+}
+
+func TestDecodeStrictRecipe(t *testing.T) {
+	data := `{"id": 1, "latest_revision": ` + string(revision(`, "bogusField": 1`, "")) + `}`
+	if _, err := DecodeRecipe([]byte(data), Strict); err == nil {
+		t.Error("DecodeRecipe strict decoded an unknown argument")
+	}
+	if _, err := DecodeRecipe([]byte(data), Lenient); err != nil {
+		t.Errorf("DecodeRecipe lenient err = %v", err)
+	}
+}
+
+func TestLenientLogsSkipped(t *testing.T) {
+	var buf bytes.Buffer
+	defer func(l *Logger) { Log = l }(Log)
+	Log = NewLogger(&buf, LevelInfo)
+
+	revisions, err := DecodeHistory([]byte(`[{"id": 1}, {"id": "two"}]`), Lenient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revisions) != 1 {
+		t.Errorf("got %d revisions, want 1", len(revisions))
+	}
+	if !strings.HasPrefix(buf.String(), "WARN  Skipped record") {
+		t.Errorf("skipped revision logged %q", buf.String())
+	}
+
+	var skipped []error
+	buf.Reset()
+	opts := DecodeOptions{OnError: func(err error) { skipped = append(skipped, err) }}
+	if _, err := DecodeHistory([]byte(`[{"id": "two"}]`), opts); err != nil {
+		t.Fatal(err)
+	}
+	if len(skipped) != 1 || buf.Len() != 0 {
+		t.Errorf("OnError got %d errors and the log %q, want 1 error and no log", len(skipped), buf.String())
+	}
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// MaxRetries is how many times a failed request is retried before
+	// giving up.  Zero turns retrying off.
+	MaxRetries = 4
+
+	// RetryBaseDelay is the delay before the first retry, it doubles with
+	// every attempt up to RetryMaxDelay.  Responses with a longer
+	// Retry-After aren't retried.
+	RetryBaseDelay = 500 * time.Millisecond
+	RetryMaxDelay  = 30 * time.Second
+)
+
+// retry calls fn until it succeeds, returns an error that isn't worth
+// retrying, MaxRetries is used up or ctx is done.  It returns the number
+// of attempts made.  url is only for logging.
+func retry(ctx context.Context, url string, fn func() (*CacheEntry, error)) (*CacheEntry, int, error) {
+	for attempt := 1; ; attempt++ {
+		entry, err := fn()
+		if err == nil {
+			return entry, attempt, nil
+		}
+
+		if attempt > MaxRetries || ctx.Err() != nil || !retryable(err) {
+			return nil, attempt, err
+		}
+
+		delay := backoff(attempt)
+		if se, ok := err.(*StatusError); ok && se.RetryAfter > 0 {
+			// waiting hours for one url isn't worth it, give up so it is
+			// reported as lost
+			if se.RetryAfter > RetryMaxDelay {
+				Log.Warn("Not retrying, Retry-After is longer than the max delay", "url", url, "retry_after", se.RetryAfter)
+				return nil, attempt, err
+			}
+			delay = se.RetryAfter
+		}
+		Log.Debug("Retrying", "url", url, "attempt", attempt, "delay", delay, "err", err)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, attempt, err
+		}
+	}
+}
+
+// backoff is the jittered, exponential delay before retrying attempt
+func backoff(attempt int) time.Duration {
+	delay := RetryMaxDelay
+	if attempt < 32 {
+		if d := RetryBaseDelay << uint(attempt-1); d > 0 && d < RetryMaxDelay {
+			delay = d
+		}
+	}
+
+	// somewhere between half and all of the delay so workers that failed
+	// together don't all retry together
+	half := int64(delay / 2)
+	if half <= 0 {
+		return delay
+	}
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// retryable is true for errors that are likely to go away on their own:
+// 429s, 5xx responses, timeouts and dropped connections
+func retryable(err error) bool {
+	if se, ok := err.(*StatusError); ok {
+		return se.Code == http.StatusTooManyRequests || se.Code >= 500
+	}
+
+	// per request timeouts, the caller's context was checked already
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, io.EOF)
+}
+
+// parseRetryAfter understands both forms of the Retry-After header, delay
+// seconds and an http date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if secs, err := strconv.Atoi(value); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+
+	if t, err := http.ParseTime(value); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+
+	return 0
+}
+
+// FailedURL is a url that could not be fetched, even after retrying
+type FailedURL struct {
+	URL      string
+	Attempts int
+	Err      error
+}
+
+var (
+	failuresLock sync.Mutex
+	failures     = make(map[string]FailedURL)
+)
+
+func recordFailure(url string, attempts int, err error) {
+	// cancelling isn't losing data, the whole run is stopping
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+	failures[url] = FailedURL{url, attempts, err}
+}
+
+// Failures returns every url Get gave up on, sorted by url
+func Failures() []FailedURL {
+	failuresLock.Lock()
+	defer failuresLock.Unlock()
+
+	list := make([]FailedURL, 0, len(failures))
+	for _, f := range failures {
+		list = append(list, f)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].URL < list[j].URL })
+	return list
+}
+
+// PrintFailures writes a summary of Failures() to w so reports that are
+// missing data say so.  It writes nothing if every fetch worked.
+func PrintFailures(w io.Writer) {
+	list := Failures()
+	if len(list) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "!! %d url(s) could not be fetched, results are incomplete:\n", len(list))
+	for _, f := range list {
+		fmt.Fprintf(w, "   %s (%d attempts): %s\n", f.URL, f.Attempts, f.Err.Error())
+	}
+}
@@ -0,0 +1,62 @@
+package tools
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRetryAfter(t *testing.T) {
+	defer func(base, max time.Duration) { RetryBaseDelay, RetryMaxDelay = base, max }(RetryBaseDelay, RetryMaxDelay)
+	RetryBaseDelay, RetryMaxDelay = time.Millisecond, 50*time.Millisecond
+
+	tests := []struct {
+		name       string
+		retryAfter time.Duration
+		attempts   int
+	}{
+		{"no retry-after", 0, MaxRetries + 1},
+		{"short retry-after", time.Millisecond, MaxRetries + 1},
+		{"retry-after over the max delay", 24 * time.Hour, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			_, attempts, err := retry(context.Background(), "http://example.com/", func() (*CacheEntry, error) {
+				calls++
+				return nil, &StatusError{Code: http.StatusTooManyRequests, RetryAfter: test.retryAfter}
+			})
+
+			if err == nil {
+				t.Fatal("retry succeeded")
+			}
+			if attempts != test.attempts || calls != test.attempts {
+				t.Errorf("got %d attempts and %d calls, want %d", attempts, calls, test.attempts)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 7, 2, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"5", 5 * time.Second},
+		{"-5", 0},
+		{"86400", 24 * time.Hour},
+		{"Thu, 02 Jul 2020 12:01:00 GMT", time.Minute},
+		{"Thu, 02 Jul 2020 11:00:00 GMT", 0},
+		{"soon", 0},
+	}
+
+	for _, test := range tests {
+		if got := parseRetryAfter(test.value, now); got != test.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", test.value, got, test.want)
+		}
+	}
+}
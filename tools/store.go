@@ -0,0 +1,362 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+)
+
+// StoreDirEnv is the environment variable that overrides the default store dir
+const StoreDirEnv = "NORMANDY_TOOLS_STORE_DIR"
+
+const (
+	snapshotFormat  = "normandy-tools-snapshot"
+	snapshotVersion = 1
+
+	// snapshotLayout names snapshot files so they sort by time
+	snapshotLayout = "20060102T150405Z"
+)
+
+// ErrNoSnapshots is returned when the store has no snapshot to read
+var ErrNoSnapshots = errors.New("No snapshots, run sync first")
+
+// ErrNotInSnapshot is returned by Get for urls a snapshot can't answer
+var ErrNotInSnapshot = errors.New("Not in snapshot")
+
+// DefaultStoreDir is $NORMANDY_TOOLS_STORE_DIR if it is set, otherwise a
+// normandy-tools dir in the user's data dir ($XDG_DATA_HOME or
+// ~/.local/share).  Unlike the cache it is not safe to delete.
+func DefaultStoreDir() string {
+	if dir := os.Getenv(StoreDirEnv); dir != "" {
+		return dir
+	}
+
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "normandy-tools")
+	}
+
+	if home, err := os.UserHomeDir(); err == nil {
+		return filepath.Join(home, ".local", "share", "normandy-tools")
+	}
+
+	return filepath.Join(os.TempDir(), "normandy-tools-store")
+}
+
+// Store keeps snapshots of every recipe and its revision history, one JSONL
+// file per sync.  Old snapshots are kept so they can be compared.
+type Store struct {
+	Dir string
+}
+
+// StoredRecipe is a recipe and its history as the API sent them
+type StoredRecipe struct {
+	ID      int             `json:"id"`
+	Recipe  json.RawMessage `json:"recipe"`
+	History json.RawMessage `json:"history"`
+}
+
+// LatestRevision is the recipe's latest_revision compacted, sync compares it
+// to find the recipes that changed
+func (r *StoredRecipe) LatestRevision() []byte {
+	value, dataType, _, err := jsonparser.Get(r.Recipe, "latest_revision")
+	if err != nil || dataType == jsonparser.Null {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, value); err != nil {
+		return value
+	}
+	return buf.Bytes()
+}
+
+// snapshotHeader is the first line of a snapshot file
+type snapshotHeader struct {
+	Format  string    `json:"format"`
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	BaseURL string    `json:"base_url"`
+}
+
+// SnapshotInfo is a snapshot file in a store
+type SnapshotInfo struct {
+	Path    string
+	Created time.Time
+}
+
+// Snapshots lists the store's snapshots, oldest first
+func (s *Store) Snapshots() ([]SnapshotInfo, error) {
+	files, err := ioutil.ReadDir(s.Dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "Failed reading store")
+	}
+
+	var list []SnapshotInfo
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+
+		t, err := time.Parse(snapshotLayout, strings.TrimSuffix(name, ".jsonl"))
+		if err != nil {
+			continue
+		}
+		list = append(list, SnapshotInfo{Path: filepath.Join(s.Dir, name), Created: t})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+	return list, nil
+}
+
+// Find returns the snapshot spec names: "latest", the path of a snapshot
+// file or a time, which picks the last snapshot made at or before it.
+// Times are anything ParseTime understands, ie: 2020-07-02 or 7d.
+func (s *Store) Find(spec string, now time.Time) (SnapshotInfo, error) {
+	if strings.HasSuffix(spec, ".jsonl") {
+		if _, err := os.Stat(spec); err != nil {
+			return SnapshotInfo{}, errors.Wrap(err, "Failed finding snapshot")
+		}
+		t, _ := time.Parse(snapshotLayout, strings.TrimSuffix(filepath.Base(spec), ".jsonl"))
+		return SnapshotInfo{Path: spec, Created: t}, nil
+	}
+
+	list, err := s.Snapshots()
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+	if len(list) == 0 {
+		return SnapshotInfo{}, errors.Wrap(ErrNoSnapshots, s.Dir)
+	}
+
+	if spec == "latest" {
+		return list[len(list)-1], nil
+	}
+
+	at, err := ParseTime(spec, now)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	for i := len(list) - 1; i >= 0; i-- {
+		if list[i].Created.Unix() <= at {
+			return list[i], nil
+		}
+	}
+	return SnapshotInfo{}, errors.Errorf("No snapshot before %s, the first is from %s",
+		spec, list[0].Created.Format(time.RFC3339))
+}
+
+// Save writes recipes as a new snapshot and returns its path
+func (s *Store) Save(recipes []StoredRecipe, baseURL string, created time.Time) (string, error) {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", errors.Wrap(err, "Failed creating store dir")
+	}
+
+	// written to a temp file first so a failed sync doesn't leave half a
+	// snapshot behind
+	tmp, err := ioutil.TempFile(s.Dir, ".snapshot-")
+	if err != nil {
+		return "", errors.Wrap(err, "Failed creating snapshot")
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	// keep the API's JSON as it is, ie: && in filter expressions
+	enc.SetEscapeHTML(false)
+	header := snapshotHeader{snapshotFormat, snapshotVersion, created.UTC(), baseURL}
+	if err := enc.Encode(header); err != nil {
+		tmp.Close()
+		return "", errors.Wrap(err, "Failed writing snapshot")
+	}
+	for i := range recipes {
+		if err := enc.Encode(&recipes[i]); err != nil {
+			tmp.Close()
+			return "", errors.Wrapf(err, "Failed writing recipe %d", recipes[i].ID)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return "", errors.Wrap(err, "Failed writing snapshot")
+	}
+	if err := tmp.Close(); err != nil {
+		return "", errors.Wrap(err, "Failed writing snapshot")
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", errors.Wrap(err, "Failed saving snapshot")
+	}
+
+	path := filepath.Join(s.Dir, created.UTC().Format(snapshotLayout)+".jsonl")
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", errors.Wrap(err, "Failed saving snapshot")
+	}
+	return path, nil
+}
+
+// Snapshot is every recipe and its history at the time of a sync
+type Snapshot struct {
+	Path    string
+	Created time.Time
+	BaseURL string
+	Recipes []StoredRecipe
+
+	byID map[int]*StoredRecipe
+}
+
+// LoadSnapshot reads a snapshot file
+func LoadSnapshot(path string) (*Snapshot, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed opening snapshot")
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(bufio.NewReader(f))
+
+	var header snapshotHeader
+	if err := dec.Decode(&header); err != nil {
+		return nil, errors.Wrapf(err, "Failed reading snapshot %s", path)
+	}
+	if header.Format != snapshotFormat || header.Version != snapshotVersion {
+		return nil, errors.Errorf("%s is not a version %d snapshot", path, snapshotVersion)
+	}
+
+	s := &Snapshot{
+		Path:    path,
+		Created: header.Created,
+		BaseURL: header.BaseURL,
+		byID:    make(map[int]*StoredRecipe),
+	}
+
+	for {
+		var r StoredRecipe
+		if err := dec.Decode(&r); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, errors.Wrapf(err, "Failed reading snapshot %s", path)
+		}
+		s.Recipes = append(s.Recipes, r)
+	}
+
+	for i := range s.Recipes {
+		s.byID[s.Recipes[i].ID] = &s.Recipes[i]
+	}
+	return s, nil
+}
+
+// Recipe returns the stored recipe with id, or nil
+func (s *Snapshot) Recipe(id int) *StoredRecipe {
+	return s.byID[id]
+}
+
+// Get answers an API request from the snapshot so commands can run without
+// the network.  The recipe list comes back as a single page in the order
+// asked for with ?ordering= (id or latest_revision, - for descending).
+func (s *Snapshot) Get(url string) ([]byte, error) {
+	base := RecipeURL()
+	if !strings.HasPrefix(url, base) {
+		return nil, errors.Wrap(ErrNotInSnapshot, url)
+	}
+
+	path, query := strings.TrimPrefix(url, base), ""
+	if i := strings.Index(path, "?"); i >= 0 {
+		path, query = path[:i], path[i+1:]
+	}
+
+	if path == "" {
+		return s.page(query)
+	}
+
+	if strings.HasSuffix(path, "/history/") {
+		id, err := strconv.Atoi(strings.TrimSuffix(path, "/history/"))
+		if err == nil && s.byID[id] != nil {
+			return s.byID[id].History, nil
+		}
+	}
+
+	return nil, errors.Wrap(ErrNotInSnapshot, url)
+}
+
+// page builds a /recipe/ page with every recipe in the snapshot
+func (s *Snapshot) page(query string) ([]byte, error) {
+	recipes := make([]*StoredRecipe, len(s.Recipes))
+	for i := range s.Recipes {
+		recipes[i] = &s.Recipes[i]
+	}
+
+	var ordering string
+	for _, param := range strings.Split(query, "&") {
+		if strings.HasPrefix(param, "ordering=") {
+			ordering = strings.TrimPrefix(param, "ordering=")
+		}
+	}
+
+	descending := strings.HasPrefix(ordering, "-")
+	key := func(r *StoredRecipe) int64 { return int64(r.ID) }
+	switch strings.TrimPrefix(ordering, "-") {
+	case "", "id":
+	case "latest_revision":
+		key = func(r *StoredRecipe) int64 {
+			id, _ := jsonparser.GetInt(r.Recipe, "latest_revision", "id")
+			return id
+		}
+	default:
+		return nil, errors.Errorf("Snapshots can't be ordered by %q", ordering)
+	}
+
+	sort.SliceStable(recipes, func(i, j int) bool {
+		if descending {
+			return key(recipes[i]) > key(recipes[j])
+		}
+		return key(recipes[i]) < key(recipes[j])
+	})
+
+	var buf bytes.Buffer
+	buf.WriteString(`{"count":`)
+	buf.WriteString(strconv.Itoa(len(recipes)))
+	buf.WriteString(`,"next":null,"previous":null,"results":[`)
+	for i, r := range recipes {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(r.Recipe)
+	}
+	buf.WriteString("]}")
+	return buf.Bytes(), nil
+}
+
+var (
+	snapshotLock sync.Mutex
+	snapshot     *Snapshot
+)
+
+// UseSnapshot makes Get answer from s instead of the network, nil goes back
+// to the network
+func UseSnapshot(s *Snapshot) {
+	snapshotLock.Lock()
+	defer snapshotLock.Unlock()
+	snapshot = s
+}
+
+// CurrentSnapshot is the snapshot Get reads from, or nil
+func CurrentSnapshot() *Snapshot {
+	snapshotLock.Lock()
+	defer snapshotLock.Unlock()
+	return snapshot
+}
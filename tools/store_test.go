@@ -0,0 +1,202 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// tempStore is an empty store that's removed when the test ends
+func tempStore(t *testing.T) *Store {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "normandy-tools-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return &Store{Dir: filepath.Join(dir, "prod")}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := tempStore(t)
+	created := time.Date(2020, 7, 2, 12, 0, 0, 0, time.FixedZone("CEST", 2*60*60))
+
+	recipes := []StoredRecipe{
+		{
+			ID:      1,
+			Recipe:  json.RawMessage(`{"id":1,"latest_revision":{"id": 5,  "extra_filter_expression": "a && b < c"}}`),
+			History: json.RawMessage(`[{"id":5},{"id":4}]`),
+		},
+		{
+			ID:      2,
+			Recipe:  json.RawMessage(`{"id":2,"latest_revision":null}`),
+			History: json.RawMessage(`[]`),
+		},
+	}
+
+	path, err := store.Save(recipes, "https://normandy.cdn.mozilla.net/api/v3/", created)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(store.Dir, "20200702T100000Z.jsonl"); path != want {
+		t.Errorf("saved to %s, want %s", path, want)
+	}
+
+	s, err := LoadSnapshot(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !s.Created.Equal(created) || s.BaseURL != "https://normandy.cdn.mozilla.net/api/v3/" || s.Path != path {
+		t.Errorf("loaded %s from %s with %s", s.Path, s.Created, s.BaseURL)
+	}
+	if len(s.Recipes) != len(recipes) {
+		t.Fatalf("loaded %d recipes, want %d", len(s.Recipes), len(recipes))
+	}
+
+	// the API's JSON is only compacted, && isn't escaped
+	compact := func(data []byte) string {
+		var buf bytes.Buffer
+		json.Compact(&buf, data)
+		return buf.String()
+	}
+	for _, want := range recipes {
+		got := s.Recipe(want.ID)
+		if got == nil {
+			t.Errorf("recipe %d is missing", want.ID)
+			continue
+		}
+		if string(got.Recipe) != compact(want.Recipe) || string(got.History) != compact(want.History) {
+			t.Errorf("recipe %d = %s %s, want %s %s", want.ID, got.Recipe, got.History, want.Recipe, want.History)
+		}
+	}
+	if s.Recipe(3) != nil {
+		t.Error("found recipe 3")
+	}
+
+	if got := string(s.Recipe(1).LatestRevision()); got != `{"id":5,"extra_filter_expression":"a && b < c"}` {
+		t.Errorf("LatestRevision = %s", got)
+	}
+	if got := s.Recipe(2).LatestRevision(); got != nil {
+		t.Errorf("LatestRevision of a null revision = %s", got)
+	}
+}
+
+func TestLoadSnapshotErrors(t *testing.T) {
+	store := tempStore(t)
+	if err := os.MkdirAll(store.Dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	files := map[string]string{
+		"not json":     "recipes\n",
+		"other format": `{"format":"something-else","version":1}` + "\n",
+		"newer":        `{"format":"normandy-tools-snapshot","version":2}` + "\n",
+		"bad recipe":   `{"format":"normandy-tools-snapshot","version":1}` + "\n" + `{"id":1,` + "\n",
+	}
+
+	for name, content := range files {
+		path := filepath.Join(store.Dir, name+".jsonl")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSnapshot(path); err == nil {
+			t.Errorf("%s: LoadSnapshot didn't fail", name)
+		}
+	}
+
+	if _, err := LoadSnapshot(filepath.Join(store.Dir, "missing.jsonl")); err == nil {
+		t.Error("LoadSnapshot of a missing file didn't fail")
+	}
+}
+
+func TestStoreFind(t *testing.T) {
+	store := tempStore(t)
+	now := time.Date(2020, 7, 10, 12, 0, 0, 0, time.UTC)
+
+	if _, err := store.Find("latest", now); !errors.Is(err, ErrNoSnapshots) {
+		t.Errorf("Find in an empty store = %v, want ErrNoSnapshots", err)
+	}
+
+	dates := []time.Time{
+		time.Date(2020, 6, 30, 9, 0, 0, 0, time.UTC),
+		time.Date(2020, 7, 2, 12, 0, 0, 0, time.UTC),
+		time.Date(2020, 7, 8, 0, 0, 0, 0, time.UTC),
+	}
+	paths := make([]string, len(dates))
+	for i, date := range dates {
+		path, err := store.Save(nil, "", date)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths[i] = path
+	}
+
+	// other files in the store are ignored
+	for _, name := range []string{"notes.txt", "latest.jsonl.tmp", "2020.jsonl", ".snapshot-123"} {
+		ioutil.WriteFile(filepath.Join(store.Dir, name), []byte("x"), 0644)
+	}
+
+	list, err := store.Snapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(dates) {
+		t.Fatalf("Snapshots = %+v, want %d", list, len(dates))
+	}
+	for i := range list {
+		if list[i].Path != paths[i] || !list[i].Created.Equal(dates[i]) {
+			t.Errorf("Snapshots[%d] = %+v, want %s", i, list[i], paths[i])
+		}
+	}
+
+	tests := []struct {
+		spec string
+		want int // index in dates
+	}{
+		{"latest", 2},
+		{paths[0], 0},
+		{"2020-07-02", 0}, // midnight, before that day's sync
+		{"2020-07-02T12:00:00Z", 1},
+		{"2020-07-03", 1},
+		{"2020-08", 2},
+		{"7d", 1},
+		{"2d", 2},
+		{"1w", 1},
+		{"240h", 0},
+	}
+
+	for _, test := range tests {
+		got, err := store.Find(test.spec, now)
+		if err != nil {
+			t.Errorf("Find(%s) error: %v", test.spec, err)
+			continue
+		}
+		if got.Path != paths[test.want] || !got.Created.Equal(dates[test.want]) {
+			t.Errorf("Find(%s) = %s, want %s", test.spec, got.Path, paths[test.want])
+		}
+	}
+
+	for _, spec := range []string{"2020-06-29", "30d", "yesterday", filepath.Join(store.Dir, "missing.jsonl")} {
+		if got, err := store.Find(spec, now); err == nil {
+			t.Errorf("Find(%s) = %s, want an error", spec, got.Path)
+		}
+	}
+
+	// a snapshot file doesn't have to be in the store
+	other := tempStore(t)
+	path, err := other.Save(nil, "", dates[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := store.Find(path, now); err != nil || got.Path != path || !got.Created.Equal(dates[0]) {
+		t.Errorf("Find(%s) = %+v, %v", path, got, err)
+	}
+}
@@ -1,7 +1,6 @@
 package tools
 
 import (
-	"fmt"
 	"time"
 )
 
@@ -12,7 +11,7 @@ func RFC3339ToUnix(t string) int64 {
 	}
 	tt, err := time.Parse(time.RFC3339, t)
 	if err != nil {
-		fmt.Println("Failed parsing", t, err.Error())
+		Log.Warn("Failed parsing time", "time", t, "err", err)
 		return 0
 	} else {
 		return tt.Unix()
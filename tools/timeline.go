@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Interval is a stretch of time a recipe stayed enabled, or disabled.
+// Revisions that don't change whether it is enabled don't end an interval.
+type Interval struct {
+	Enabled bool
+	Start   time.Time
+	End     time.Time
+
+	// Ongoing is true for the last interval, it ends now
+	Ongoing bool
+}
+
+func (i Interval) Duration() time.Duration {
+	return i.End.Sub(i.Start)
+}
+
+// Timeline is a recipe's history as intervals, oldest first
+type Timeline []Interval
+
+// NewTimeline works out when a recipe was enabled from its revisions'
+// enabled_states, the last state lasts until now.  Revisions without any
+// states, like drafts, never changed whether the recipe was enabled.  Only
+// when no revision has states, ie: older exports, is each revision taken to
+// start the state it was saved with when it was created.  The recipe is
+// disabled from its first revision until something enables it.  Times that
+// aren't valid are left out.
+func NewTimeline(history []Revision, now time.Time) Timeline {
+	type change struct {
+		at      time.Time
+		enabled bool
+	}
+
+	var changes []change
+	add := func(date string, enabled bool) {
+		if ts := RFC3339ToUnix(date); ts != 0 {
+			changes = append(changes, change{time.Unix(ts, 0).UTC(), enabled})
+		}
+	}
+
+	states := HasEnabledStates(history)
+
+	var created time.Time
+	for _, rev := range history {
+		if ts := RFC3339ToUnix(rev.DateCreated); ts != 0 {
+			if at := time.Unix(ts, 0).UTC(); created.IsZero() || at.Before(created) {
+				created = at
+			}
+		}
+
+		if !states {
+			add(rev.DateCreated, rev.Enabled)
+			continue
+		}
+		for _, state := range rev.EnabledStates {
+			add(state.Created, state.Enabled)
+		}
+	}
+
+	// the API sends the newest revision and state first but lets not assume
+	// things
+	sort.SliceStable(changes, func(i, j int) bool { return changes[i].at.Before(changes[j].at) })
+
+	if !created.IsZero() && (len(changes) == 0 || created.Before(changes[0].at)) {
+		changes = append([]change{{created, false}}, changes...)
+	}
+
+	var t Timeline
+	for _, c := range changes {
+		if n := len(t); n > 0 {
+			if t[n-1].Enabled == c.enabled {
+				continue
+			}
+			t[n-1].End = c.at
+		}
+		t = append(t, Interval{Enabled: c.enabled, Start: c.at})
+	}
+
+	if n := len(t); n > 0 {
+		last := &t[n-1]
+		last.End, last.Ongoing = now, true
+		if last.End.Before(last.Start) {
+			last.End = last.Start
+		}
+	}
+	return t
+}
+
+// HasEnabledStates is true when any revision in history has enabled_states.
+// Without them a revision's enabled is all there is to go on.
+func HasEnabledStates(history []Revision) bool {
+	for _, rev := range history {
+		if len(rev.EnabledStates) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Live is true when the recipe is enabled now
+func (t Timeline) Live() bool {
+	return len(t) > 0 && t[len(t)-1].Enabled
+}
+
+// Launches is how many times the recipe went from disabled, or not existing,
+// to enabled
+func (t Timeline) Launches() int {
+	n := 0
+	for _, i := range t {
+		if i.Enabled {
+			n++
+		}
+	}
+	return n
+}
+
+// LiveTime is how long the recipe was enabled in total
+func (t Timeline) LiveTime() time.Duration {
+	var d time.Duration
+	for _, i := range t {
+		if i.Enabled {
+			d += i.Duration()
+		}
+	}
+	return d
+}
+
+// LongestRun is the longest the recipe stayed enabled without a pause
+func (t Timeline) LongestRun() time.Duration {
+	var longest time.Duration
+	for _, i := range t {
+		if i.Enabled && i.Duration() > longest {
+			longest = i.Duration()
+		}
+	}
+	return longest
+}
+
+// Render draws the timeline from from to to in width characters: # where the
+// recipe was enabled, - where it was disabled and a space before its first
+// revision.  A character is # if the recipe was enabled at all in its slice
+// of time so short runs still show up.
+func (t Timeline) Render(from, to time.Time, width int) string {
+	if width <= 0 || !to.After(from) {
+		return ""
+	}
+
+	step := to.Sub(from) / time.Duration(width)
+	if step <= 0 {
+		step = 1
+	}
+
+	var b strings.Builder
+	for n := 0; n < width; n++ {
+		start := from.Add(time.Duration(n) * step)
+		end := start.Add(step)
+
+		c := byte(' ')
+		for _, i := range t {
+			if !i.Start.Before(end) || !i.End.After(start) {
+				continue
+			}
+			if i.Enabled {
+				c = '#'
+				break
+			}
+			c = '-'
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,155 @@
+package tools
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func day(d int) time.Time {
+	return time.Date(2020, 1, d, 0, 0, 0, 0, time.UTC)
+}
+
+func stamp(d int) string {
+	return day(d).Format(time.RFC3339)
+}
+
+func TestNewTimeline(t *testing.T) {
+	now := day(20)
+
+	tests := []struct {
+		name    string
+		history string
+		want    Timeline
+	}{
+		{
+			name: "enabled states",
+			// newest first, like the API
+			history: `[
+				{"id": 2, "date_created": "` + stamp(8) + `", "enabled": true, "enabled_states": [
+					{"id": 14, "revision_id": 2, "created": "` + stamp(9) + `", "enabled": true, "carryover_from": 13, "creator": null}
+				]},
+				{"id": 1, "date_created": "` + stamp(1) + `", "enabled": true, "enabled_states": [
+					{"id": 13, "revision_id": 1, "created": "` + stamp(7) + `", "enabled": true, "carryover_from": null, "creator": {"id": 1}},
+					{"id": 12, "revision_id": 1, "created": "` + stamp(5) + `", "enabled": false, "carryover_from": null, "creator": {"id": 1}},
+					{"id": 11, "revision_id": 1, "created": "` + stamp(3) + `", "enabled": true, "carryover_from": null, "creator": {"id": 1}}
+				]}
+			]`,
+			want: Timeline{
+				{Enabled: false, Start: day(1), End: day(3)},
+				{Enabled: true, Start: day(3), End: day(5)},
+				{Enabled: false, Start: day(5), End: day(7)},
+				{Enabled: true, Start: day(7), End: now, Ongoing: true},
+			},
+		},
+		{
+			name: "states win over enabled",
+			history: `[
+				{"id": 1, "date_created": "` + stamp(1) + `", "enabled": false, "enabled_states": [
+					{"id": 12, "revision_id": 1, "created": "` + stamp(4) + `", "enabled": false},
+					{"id": 11, "revision_id": 1, "created": "` + stamp(2) + `", "enabled": true}
+				]}
+			]`,
+			want: Timeline{
+				{Enabled: false, Start: day(1), End: day(2)},
+				{Enabled: true, Start: day(2), End: day(4)},
+				{Enabled: false, Start: day(4), End: now, Ongoing: true},
+			},
+		},
+		{
+			name: "no enabled states",
+			history: `[
+				{"id": 3, "date_created": "` + stamp(10) + `", "enabled": false},
+				{"id": 2, "date_created": "` + stamp(5) + `", "enabled": true},
+				{"id": 1, "date_created": "` + stamp(1) + `", "enabled": true}
+			]`,
+			want: Timeline{
+				{Enabled: true, Start: day(1), End: day(10)},
+				{Enabled: false, Start: day(10), End: now, Ongoing: true},
+			},
+		},
+		{
+			// revision 2 is a draft, the recipe stays enabled
+			name: "draft",
+			history: `[
+				{"id": 2, "date_created": "` + stamp(6) + `", "enabled": false},
+				{"id": 1, "date_created": "` + stamp(1) + `", "enabled": true, "enabled_states": [
+					{"id": 11, "revision_id": 1, "created": "` + stamp(3) + `", "enabled": true}
+				]}
+			]`,
+			want: Timeline{
+				{Enabled: false, Start: day(1), End: day(3)},
+				{Enabled: true, Start: day(3), End: now, Ongoing: true},
+			},
+		},
+		{
+			name: "invalid dates",
+			history: `[
+				{"id": 2, "date_created": "yesterday", "enabled": false},
+				{"id": 1, "date_created": "` + stamp(1) + `", "enabled": true, "enabled_states": [
+					{"id": 11, "revision_id": 1, "created": "", "enabled": false}
+				]}
+			]`,
+			want: Timeline{
+				{Enabled: false, Start: day(1), End: now, Ongoing: true},
+			},
+		},
+		{
+			name: "after now",
+			history: `[
+				{"id": 1, "date_created": "` + stamp(25) + `", "enabled": true}
+			]`,
+			want: Timeline{
+				{Enabled: true, Start: day(25), End: day(25), Ongoing: true},
+			},
+		},
+		{
+			name:    "empty",
+			history: `[]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			history, err := DecodeHistory([]byte(test.history), Strict)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := NewTimeline(history, now)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("NewTimeline =\n%+v\nwant\n%+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTimelineStats(t *testing.T) {
+	timeline := Timeline{
+		{Enabled: false, Start: day(1), End: day(3)},
+		{Enabled: true, Start: day(3), End: day(5)},
+		{Enabled: false, Start: day(5), End: day(7)},
+		{Enabled: true, Start: day(7), End: day(10), Ongoing: true},
+	}
+
+	if !timeline.Live() {
+		t.Error("Live = false")
+	}
+	if n := timeline.Launches(); n != 2 {
+		t.Errorf("Launches = %d, want 2", n)
+	}
+	if d := timeline.LiveTime(); d != 5*24*time.Hour {
+		t.Errorf("LiveTime = %s, want 120h", d)
+	}
+	if d := timeline.LongestRun(); d != 3*24*time.Hour {
+		t.Errorf("LongestRun = %s, want 72h", d)
+	}
+	if s := timeline.Render(day(1), day(11), 10); s != "--##--### " {
+		t.Errorf("Render = %q", s)
+	}
+
+	var empty Timeline
+	if empty.Live() || empty.Launches() != 0 || empty.LiveTime() != 0 {
+		t.Error("empty timeline isn't empty")
+	}
+}
@@ -0,0 +1,115 @@
+package tools
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CompareVersions compares Firefox version strings the way Firefox's
+// versionCompare does, returning -1, 0 or 1.  Versions are dot separated
+// parts, each part is a number, a string, a number and the rest, ie: 78.0b3
+// is parts 78 and 0/"b"/3.  Missing parts are 0 and a missing string sorts
+// after any string so 78.0a1 < 78.0.  "*" is larger than any number, that's
+// how "78.*" is every version of 78.
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+
+	for len(as) < len(bs) {
+		as = append(as, "0")
+	}
+	for len(bs) < len(as) {
+		bs = append(bs, "0")
+	}
+
+	for i := range as {
+		if c := parseVersionPart(as[i]).compare(parseVersionPart(bs[i])); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+type versionPart struct {
+	numA int
+	strB string
+	numC int
+	extD string
+}
+
+func parseVersionPart(s string) versionPart {
+	var p versionPart
+	if s == "*" {
+		p.numA = math.MaxInt32
+		return p
+	}
+
+	p.numA, s = leadingNumber(s)
+
+	// 1.1+ is the same as 1.2pre
+	if s == "+" {
+		p.numA++
+		p.strB = "pre"
+		return p
+	}
+
+	i := strings.IndexAny(s, "0123456789+-")
+	if i == -1 {
+		p.strB = s
+		return p
+	}
+	p.strB = s[:i]
+	p.numC, p.extD = leadingNumber(s[i:])
+	return p
+}
+
+// leadingNumber parses the digits at the start of s and returns the rest
+func leadingNumber(s string) (int, string) {
+	i := 0
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9' || i == 0 && s[i] == '-') {
+		i++
+	}
+
+	n, err := strconv.Atoi(s[:i])
+	if err != nil {
+		return 0, s[i:]
+	}
+	return n, s[i:]
+}
+
+func (p versionPart) compare(o versionPart) int {
+	if c := compareInts(p.numA, o.numA); c != 0 {
+		return c
+	}
+	if c := compareVersionStrings(p.strB, o.strB); c != 0 {
+		return c
+	}
+	if c := compareInts(p.numC, o.numC); c != 0 {
+		return c
+	}
+	return compareVersionStrings(p.extD, o.extD)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compareVersionStrings sorts a missing string after any string
+func compareVersionStrings(a, b string) int {
+	switch {
+	case a == b:
+		return 0
+	case a == "":
+		return 1
+	case b == "":
+		return -1
+	}
+	return strings.Compare(a, b)
+}
@@ -1,46 +1,278 @@
 package tools
 
 import (
-	"io"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/buger/jsonparser"
 	"github.com/pkg/errors"
 )
 
+// ErrStopWalk can be returned by a RecordHandler to stop walking
+// early without WalkAPI treating it as an error
+var ErrStopWalk = errors.New("stop walk")
+
+// ErrPagesShifted is returned by WalkAPIParallel, after every record was
+// handled, when the collection changed while it was being read.  Records
+// may have been missed.
+var ErrPagesShifted = errors.New("Records shifted between pages")
+
 type RecordHandler func(record []byte) error
 
-// WalkAPI walks through API result pages until
-// there are no more pages or handler returns an error
-func WalkAPI(next string, handler RecordHandler) error {
-	for {
-		if next == "" {
-			break
+// apiPage is one page of a paginated API response
+type apiPage struct {
+	url     string
+	next    string
+	count   int
+	records [][]byte
+}
+
+// readPage fetches and parses the page at url
+func readPage(ctx context.Context, url string) (*apiPage, error) {
+	Log.Debug("Reading page", "url", url)
+	body, err := GetContext(ctx, url)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Failed to walk url: %s", url)
+	}
+
+	p := &apiPage{url: url}
+
+	value, dataType, _, err := jsonparser.Get(body, "next")
+	switch {
+	case err == jsonparser.KeyPathNotFoundError:
+		return nil, errors.Errorf("Malformed page, missing next: %s", url)
+	case err != nil:
+		return nil, errors.Wrapf(err, "Malformed page: %s", url)
+	case dataType == jsonparser.Null:
+		p.next = ""
+	case dataType == jsonparser.String:
+		p.next = string(value)
+	default:
+		return nil, errors.Errorf("Malformed page, next is a %s: %s", dataType, url)
+	}
+
+	// count is optional, only the parallel walker needs it
+	if count, err := jsonparser.GetInt(body, "count"); err == nil {
+		p.count = int(count)
+	}
+
+	_, err = jsonparser.ArrayEach(body, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		p.records = append(p.records, value)
+	}, "results")
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "Malformed page, bad results: %s", url)
+	}
+
+	return p, nil
+}
+
+// handle calls handler for every record on the page.  ErrStopWalk comes back
+// as is, other errors are wrapped with the record's index and the page url.
+func (p *apiPage) handle(ctx context.Context, handler RecordHandler) error {
+	for index, record := range p.records {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "Stopped walking at record %d of %s", index, p.url)
 		}
 
-		body, err := Get(next)
-		if err != nil {
-			return errors.Wrapf(err, "Failed to walk url: %s", next)
+		if err := handler(record); err == ErrStopWalk {
+			return err
+		} else if err != nil {
+			return errors.Wrapf(err, "Failed handling record %d of %s", index, p.url)
+		}
+	}
+
+	return nil
+}
+
+// WalkAPI walks through API result pages until there are no more pages,
+// handler returns an error or ctx is done.  It returns nil once the last page
+// is done or handler returned ErrStopWalk, otherwise the error is wrapped with
+// the page url and the index of the record that failed.
+func WalkAPI(ctx context.Context, next string, handler RecordHandler) error {
+	for next != "" {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "Stopped walking before: %s", next)
 		}
 
-		next, err = jsonparser.GetString(body, "next")
+		p, err := readPage(ctx, next)
 		if err != nil {
-			return io.EOF
+			return err
 		}
 
-		callHandler := true
+		if err := p.handle(ctx, handler); err == ErrStopWalk {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		next = p.next
+	}
 
-		jsonparser.ArrayEach(body, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
-			if !callHandler {
-				return
+	return nil
+}
+
+// pageURL is next with its page number changed to n, or "" if next
+// doesn't use page numbers
+func pageURL(next string, n int) string {
+	u, err := url.Parse(next)
+	if err != nil || u.Query().Get("page") == "" {
+		return ""
+	}
+
+	q := u.Query()
+	q.Set("page", strconv.Itoa(n))
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// WalkAPIParallel is WalkAPI that fetches pages with up to workers at a
+// time.  The first page is read on its own to get the total count and the
+// page size, the rest are fetched at the same time.  Records are still
+// handed to handler one at a time and in the same order WalkAPI would.
+//
+// The collection can change while it is read, moving records from one page
+// to the next or removing the last pages.  Records seen twice are only handled once, and once
+// everything is handled the walk fails with ErrPagesShifted so the caller
+// knows records may be missing.  When the API doesn't use page numbers
+// this falls back to WalkAPI.
+func WalkAPIParallel(ctx context.Context, first string, workers int, handler RecordHandler) error {
+	p, err := readPage(ctx, first)
+	if err != nil {
+		return err
+	}
+
+	pageSize := len(p.records)
+	if p.next == "" || pageSize == 0 || p.count == 0 || pageURL(p.next, 2) == "" {
+		if err := p.handle(ctx, handler); err == ErrStopWalk {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		return WalkAPI(ctx, p.next, handler)
+	}
+
+	count, next := p.count, p.next
+	numPages := (count + pageSize - 1) / pageSize
+
+	// stops the pool when we return early
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// each page gets its own channel so they can be handled in order no
+	// matter which one finishes first
+	pool := NewPool(ctx, workers)
+	pages := make([]chan Result, numPages+1)
+	for n := 2; n <= numPages; n++ {
+		pages[n] = make(chan Result, 1)
+	}
+
+	go func() {
+		for n := 2; n <= numPages; n++ {
+			url := pageURL(next, n)
+			done := pages[n]
+			err := pool.Submit(url, func(ctx context.Context) (interface{}, error) {
+				page, err := readPage(ctx, url)
+				done <- Result{Name: url, Value: page, Err: err}
+				return nil, err
+			})
+
+			if err != nil {
+				done <- Result{Name: url, Err: err}
 			}
+		}
+		pool.Wait()
+	}()
 
-			if err := handler(value); err != nil {
-				// clear out next so we don't parse anymore
-				next = ""
-				callHandler = false
+	seen := make(map[int64]bool, count)
+	shifted := ""
+	dedupe := func(record []byte) error {
+		if id, err := jsonparser.GetInt(record, "id"); err == nil {
+			if seen[id] {
+				shifted = fmt.Sprintf("record id %d was seen twice", id)
+				return nil
 			}
-		}, "results")
+			seen[id] = true
+		}
+		return handler(record)
 	}
 
-	return io.EOF
+	for n := 1; n <= numPages; n++ {
+		if n > 1 {
+			select {
+			case result := <-pages[n]:
+				// records were deleted and the last pages are gone
+				var se *StatusError
+				if errors.As(result.Err, &se) && se.Code == http.StatusNotFound {
+					shifted = fmt.Sprintf("page %d no longer exists", n)
+					continue
+				}
+				if result.Err != nil {
+					return result.Err
+				}
+				p = result.Value.(*apiPage)
+			case <-ctx.Done():
+				return errors.Wrapf(ctx.Err(), "Stopped walking before page %d of %s", n, first)
+			}
+		}
+
+		expected := pageSize
+		if n == numPages {
+			expected = count - pageSize*(numPages-1)
+		}
+
+		switch {
+		case p.count != count:
+			shifted = fmt.Sprintf("count changed from %d to %d at %s", count, p.count, p.url)
+		case len(p.records) != expected:
+			shifted = fmt.Sprintf("expected %d records, got %d at %s", expected, len(p.records), p.url)
+		case n == numPages && p.next != "":
+			shifted = fmt.Sprintf("more pages after %s", p.url)
+		}
+
+		if err := p.handle(ctx, dedupe); err == ErrStopWalk {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+
+	if shifted != "" {
+		return errors.Wrap(ErrPagesShifted, shifted)
+	}
+
+	return nil
+}
+
+type RecipeHandler func(recipe *Recipe) error
+
+// recipeHandler decodes each record into a Recipe before handing it
+// to handler
+func recipeHandler(opts DecodeOptions, handler RecipeHandler) RecordHandler {
+	return func(record []byte) error {
+		recipe, err := DecodeRecipe(record, opts)
+		if err != nil {
+			if opts.Strict {
+				return err
+			}
+			opts.skip(err)
+			return nil
+		}
+
+		return handler(recipe)
+	}
+}
+
+// WalkRecipes is WalkAPI for the /recipe/ endpoint that decodes
+// each record into a Recipe before handing it to handler
+func WalkRecipes(ctx context.Context, next string, opts DecodeOptions, handler RecipeHandler) error {
+	return WalkAPI(ctx, next, recipeHandler(opts, handler))
+}
+
+// WalkRecipesParallel is WalkRecipes on top of WalkAPIParallel
+func WalkRecipesParallel(ctx context.Context, first string, workers int, opts DecodeOptions, handler RecipeHandler) error {
+	return WalkAPIParallel(ctx, first, workers, recipeHandler(opts, handler))
 }
@@ -0,0 +1,240 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/buger/jsonparser"
+	"github.com/pkg/errors"
+)
+
+func TestMain(m *testing.M) {
+	// the tests talk to httptest servers, nothing is cached or rate limited
+	SetCache(NoCache{})
+	SetLimits(0, 0, 0)
+	os.Exit(m.Run())
+}
+
+// collection is a paginated API like Normandy's, page numbers start at 1
+// and pages past the end are 404s like Django's
+type collection struct {
+	mu       sync.Mutex
+	ids      []int
+	pageSize int
+
+	// afterFirst changes the collection once the first page is served
+	afterFirst func(ids []int) []int
+}
+
+func (c *collection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	page := 1
+	if p := r.URL.Query().Get("page"); p != "" {
+		page, _ = strconv.Atoi(p)
+	}
+
+	start := (page - 1) * c.pageSize
+	if page < 1 || (start >= len(c.ids) && page > 1) {
+		http.NotFound(w, r)
+		return
+	}
+	end := start + c.pageSize
+	if end > len(c.ids) {
+		end = len(c.ids)
+	}
+
+	var next interface{}
+	if end < len(c.ids) {
+		next = fmt.Sprintf("http://%s%s?page=%d", r.Host, r.URL.Path, page+1)
+	}
+
+	results := []map[string]int{}
+	for _, id := range c.ids[start:end] {
+		results = append(results, map[string]int{"id": id})
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"count":    len(c.ids),
+		"next":     next,
+		"previous": nil,
+		"results":  results,
+	})
+
+	if page == 1 && c.afterFirst != nil {
+		c.ids = c.afterFirst(c.ids)
+		c.afterFirst = nil
+	}
+}
+
+func ids(n int) []int {
+	list := make([]int, n)
+	for i := range list {
+		list[i] = i + 1
+	}
+	return list
+}
+
+// walk runs walker over c and returns the ids handled, in order
+func walk(t *testing.T, c *collection, stopAt int, walker func(ctx context.Context, url string, handler RecordHandler) error) ([]int, error) {
+	t.Helper()
+
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	var handled []int
+	err := walker(context.Background(), server.URL+"/recipe/", func(record []byte) error {
+		id, err := jsonparser.GetInt(record, "id")
+		if err != nil {
+			t.Fatalf("record without an id: %s", record)
+		}
+		handled = append(handled, int(id))
+		if int(id) == stopAt {
+			return ErrStopWalk
+		}
+		return nil
+	})
+	return handled, err
+}
+
+func parallel(ctx context.Context, url string, handler RecordHandler) error {
+	return WalkAPIParallel(ctx, url, 4, handler)
+}
+
+func sameIDs(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestWalkAPIParallel(t *testing.T) {
+	remove := func(id int) func([]int) []int {
+		return func(list []int) []int {
+			var out []int
+			for _, x := range list {
+				if x != id {
+					out = append(out, x)
+				}
+			}
+			return out
+		}
+	}
+
+	tests := []struct {
+		name       string
+		ids        []int
+		afterFirst func([]int) []int
+		stopAt     int
+		want       []int
+		shifted    bool
+	}{
+		{
+			name: "stable",
+			ids:  ids(10),
+			want: ids(10),
+		},
+		{
+			name: "one page",
+			ids:  ids(3),
+			want: ids(3),
+		},
+		{
+			// 3 moves to page 2, it's only handled once
+			name:       "inserted",
+			ids:        ids(10),
+			afterFirst: func(list []int) []int { return append([]int{100}, list...) },
+			want:       ids(10),
+			shifted:    true,
+		},
+		{
+			// 4 moves to page 1 and is missed, page 4 no longer exists
+			name:       "deleted",
+			ids:        ids(10),
+			afterFirst: remove(2),
+			want:       []int{1, 2, 3, 5, 6, 7, 8, 9, 10},
+			shifted:    true,
+		},
+		{
+			// a delete that leaves the number of pages the same
+			name:       "deleted same pages",
+			ids:        ids(11),
+			afterFirst: remove(5),
+			want:       []int{1, 2, 3, 4, 6, 7, 8, 9, 10, 11},
+			shifted:    true,
+		},
+		{
+			name:   "stop walk",
+			ids:    ids(10),
+			stopAt: 5,
+			want:   ids(5),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			c := &collection{ids: test.ids, pageSize: 3, afterFirst: test.afterFirst}
+			handled, err := walk(t, c, test.stopAt, parallel)
+
+			if test.shifted {
+				if !errors.Is(err, ErrPagesShifted) {
+					t.Errorf("err = %v, want ErrPagesShifted", err)
+				}
+			} else if err != nil {
+				t.Errorf("err = %v", err)
+			}
+
+			if !sameIDs(handled, test.want) {
+				t.Errorf("handled %v, want %v", handled, test.want)
+			}
+		})
+	}
+}
+
+func TestWalkAPIParallelMatchesWalkAPI(t *testing.T) {
+	for _, n := range []int{0, 1, 3, 4, 9, 10} {
+		serial, err := walk(t, &collection{ids: ids(n), pageSize: 3}, 0, WalkAPI)
+		if err != nil {
+			t.Fatal(err)
+		}
+		para, err := walk(t, &collection{ids: ids(n), pageSize: 3}, 0, parallel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !sameIDs(serial, para) || len(serial) != n {
+			t.Errorf("%d records: WalkAPI handled %v, WalkAPIParallel %v", n, serial, para)
+		}
+	}
+}
+
+func TestWalkAPIHandlerError(t *testing.T) {
+	server := httptest.NewServer(&collection{ids: ids(10), pageSize: 3})
+	defer server.Close()
+
+	failed := errors.New("failed")
+	for name, walker := range map[string]func(context.Context, string, RecordHandler) error{"WalkAPI": WalkAPI, "WalkAPIParallel": parallel} {
+		handled := 0
+		err := walker(context.Background(), server.URL+"/recipe/", func(record []byte) error {
+			if handled++; handled == 5 {
+				return failed
+			}
+			return nil
+		})
+		if !errors.Is(err, failed) || handled != 5 {
+			t.Errorf("%s: err = %v after %d records, want the handler's error after 5", name, err, handled)
+		}
+	}
+}
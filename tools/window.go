@@ -0,0 +1,118 @@
+package tools
+
+import (
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Window is the time range reports are limited to, set with -since and
+// -until.  Times are unix timestamps like RFC3339ToUnix returns, 0 is open
+// ended.
+type Window struct {
+	Since int64
+	Until int64
+
+	// Date is which date of a revision is checked: "updated" or "created"
+	Date string
+}
+
+// TimeWindow is the window from the command line flags
+var TimeWindow = Window{Date: "updated"}
+
+var relativeTime = regexp.MustCompile(`^(\d+)([dwy])$`)
+
+// ParseTime parses an absolute time (RFC3339, 2006-01-02 or 2006-01) or a
+// time relative to now (90d, 2w, 1y or a duration like 36h)
+func ParseTime(s string, now time.Time) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02", "2006-01"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Unix(), nil
+		}
+	}
+
+	if m := relativeTime.FindStringSubmatch(s); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		switch m[2] {
+		case "d":
+			return now.AddDate(0, 0, -n).Unix(), nil
+		case "w":
+			return now.AddDate(0, 0, -7*n).Unix(), nil
+		case "y":
+			return now.AddDate(-n, 0, 0).Unix(), nil
+		}
+	}
+
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return now.Add(-d).Unix(), nil
+	}
+
+	return 0, errors.Errorf("Invalid time %q, use a date like 2020-07-01 or a relative time like 90d", s)
+}
+
+// NewWindow parses since and until with ParseTime
+func NewWindow(since, until, date string, now time.Time) (Window, error) {
+	w := Window{Date: date}
+	if date != "updated" && date != "created" {
+		return w, errors.Errorf("Invalid window date %q, use updated or created", date)
+	}
+
+	var err error
+	if w.Since, err = ParseTime(since, now); err != nil {
+		return w, err
+	}
+	if w.Until, err = ParseTime(until, now); err != nil {
+		return w, err
+	}
+
+	if w.Since != 0 && w.Until != 0 && w.Since >= w.Until {
+		return w, errors.New("-since has to be before -until")
+	}
+	return w, nil
+}
+
+// IsSet is true when the window limits anything
+func (w Window) IsSet() bool {
+	return w.Since != 0 || w.Until != 0
+}
+
+// ContainsUnix is true when t is in the window, Until is not included
+func (w Window) ContainsUnix(t int64) bool {
+	if w.Since != 0 && t < w.Since {
+		return false
+	}
+	if w.Until != 0 && t >= w.Until {
+		return false
+	}
+	return true
+}
+
+// Contains is true when the RFC3339 timestamp ts is in the window.  Bad or
+// missing timestamps are only in an open window.
+func (w Window) Contains(ts string) bool {
+	if !w.IsSet() {
+		return true
+	}
+
+	t := RFC3339ToUnix(ts)
+	return t != 0 && w.ContainsUnix(t)
+}
+
+// RevisionDate is the date of rev the window checks
+func (w Window) RevisionDate(rev *Revision) string {
+	if w.Date == "created" {
+		return rev.DateCreated
+	}
+	return rev.Updated
+}
+
+// Revision is true when the revision's window date is in the window
+func (w Window) Revision(rev *Revision) bool {
+	return w.Contains(w.RevisionDate(rev))
+}
@@ -0,0 +1,122 @@
+package tools
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2020, 7, 10, 12, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		s    string
+		want time.Time
+	}{
+		{"2020-07-01T08:00:00Z", time.Date(2020, 7, 1, 8, 0, 0, 0, time.UTC)},
+		{"2020-07-01T08:00:00+02:00", time.Date(2020, 7, 1, 6, 0, 0, 0, time.UTC)},
+		{"2020-07-01", time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"2020-07", time.Date(2020, 7, 1, 0, 0, 0, 0, time.UTC)},
+		{"90d", time.Date(2020, 4, 11, 12, 30, 0, 0, time.UTC)},
+		{"0d", now},
+		{"2w", time.Date(2020, 6, 26, 12, 30, 0, 0, time.UTC)},
+		{"1y", time.Date(2019, 7, 10, 12, 30, 0, 0, time.UTC)},
+		{"36h", time.Date(2020, 7, 9, 0, 30, 0, 0, time.UTC)},
+		{"90m", time.Date(2020, 7, 10, 11, 0, 0, 0, time.UTC)},
+	}
+
+	for _, test := range tests {
+		got, err := ParseTime(test.s, now)
+		if err != nil {
+			t.Errorf("ParseTime(%q) error: %v", test.s, err)
+			continue
+		}
+		if got != test.want.Unix() {
+			t.Errorf("ParseTime(%q) = %s, want %s", test.s, time.Unix(got, 0).UTC(), test.want)
+		}
+	}
+
+	if got, err := ParseTime("", now); got != 0 || err != nil {
+		t.Errorf(`ParseTime("") = %d, %v, want 0`, got, err)
+	}
+
+	for _, s := range []string{"yesterday", "2020-13-01", "-5d", "5x", "-36h", "2020/07/01", "d"} {
+		if _, err := ParseTime(s, now); err == nil {
+			t.Errorf("ParseTime(%q) didn't fail", s)
+		}
+	}
+}
+
+func TestNewWindow(t *testing.T) {
+	now := time.Date(2020, 7, 10, 0, 0, 0, 0, time.UTC)
+	day := func(d int) int64 { return time.Date(2020, 7, d, 0, 0, 0, 0, time.UTC).Unix() }
+
+	tests := []struct {
+		since, until, date string
+		want               Window
+	}{
+		{"", "", "updated", Window{Date: "updated"}},
+		{"2020-07-01", "", "updated", Window{Since: day(1), Date: "updated"}},
+		{"", "2020-07-05", "created", Window{Until: day(5), Date: "created"}},
+		{"7d", "2020-07-05", "updated", Window{Since: day(3), Until: day(5), Date: "updated"}},
+	}
+
+	for _, test := range tests {
+		got, err := NewWindow(test.since, test.until, test.date, now)
+		if err != nil || got != test.want {
+			t.Errorf("NewWindow(%q, %q, %q) = %+v, %v, want %+v", test.since, test.until, test.date, got, err, test.want)
+		}
+	}
+
+	bad := []struct{ since, until, date string }{
+		{"2020-07-05", "2020-07-01", "updated"},
+		{"2020-07-05", "2020-07-05", "updated"},
+		{"soon", "", "updated"},
+		{"", "later", "updated"},
+		{"", "", "approved"},
+	}
+	for _, test := range bad {
+		if _, err := NewWindow(test.since, test.until, test.date, now); err == nil {
+			t.Errorf("NewWindow(%q, %q, %q) didn't fail", test.since, test.until, test.date)
+		}
+	}
+}
+
+func TestWindowContains(t *testing.T) {
+	at := func(d int) string { return time.Date(2020, 7, d, 0, 0, 0, 0, time.UTC).Format(time.RFC3339) }
+	since, _ := ParseTime("2020-07-02", time.Time{})
+	until, _ := ParseTime("2020-07-05", time.Time{})
+
+	tests := []struct {
+		w    Window
+		ts   string
+		want bool
+	}{
+		// Since is included, Until isn't
+		{Window{Since: since, Until: until}, at(1), false},
+		{Window{Since: since, Until: until}, at(2), true},
+		{Window{Since: since, Until: until}, at(4), true},
+		{Window{Since: since, Until: until}, at(5), false},
+		{Window{Since: since}, at(30), true},
+		{Window{Until: until}, "2000-01-01T00:00:00Z", true},
+
+		// bad or missing times are only in an open window
+		{Window{}, "", true},
+		{Window{}, "garbage", true},
+		{Window{Since: since}, "", false},
+		{Window{Until: until}, "garbage", false},
+	}
+
+	for _, test := range tests {
+		if got := test.w.Contains(test.ts); got != test.want {
+			t.Errorf("%+v.Contains(%q) = %v, want %v", test.w, test.ts, got, test.want)
+		}
+	}
+
+	rev := &Revision{DateCreated: at(1), Updated: at(3)}
+	if !(Window{Since: since, Date: "updated"}).Revision(rev) {
+		t.Error("window didn't check the updated date")
+	}
+	if (Window{Since: since, Date: "created"}).Revision(rev) {
+		t.Error("window didn't check the created date")
+	}
+}